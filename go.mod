@@ -1,3 +1,5 @@
 module laptudirm.com/x/mash
 
 go 1.18
+
+require golang.org/x/text v0.22.0
@@ -60,6 +60,15 @@ type BinaryCommand struct {
 func (b *BinaryCommand) Node()    {}
 func (b *BinaryCommand) Command() {}
 
+// SubshellCommand node represents a list of statements which are run in a
+// subshell.
+type SubshellCommand struct {
+	Statements []Statement
+}
+
+func (s *SubshellCommand) Node()    {}
+func (s *SubshellCommand) Command() {}
+
 // LiteralCommand node represents a primary command.
 type LiteralCommand struct {
 	Components []CommandComponent
@@ -0,0 +1,127 @@
+// Copyright © 2022 Rak Laptudirm <raklaptudirm@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"laptudirm.com/x/mash/pkg/token"
+)
+
+// Equal reports whether a and b are the same tree, ignoring the positions
+// of their tokens.
+func Equal(a, b Node) bool {
+	return Comparer{}.Equal(a, b)
+}
+
+// Diff returns a readable description of the differences between the trees
+// a and b, ignoring the positions of their tokens. It returns an empty
+// string if the trees are equal.
+func Diff(a, b Node) string {
+	return Comparer{}.Diff(a, b)
+}
+
+// Comparer compares abstract syntax trees. The zero value of Comparer is
+// ready to use.
+type Comparer struct {
+	Positions bool // compare the positions of tokens
+}
+
+// Equal reports whether a and b are the same tree.
+func (c Comparer) Equal(a, b Node) bool {
+	return c.Diff(a, b) == ""
+}
+
+// Diff returns the differences between the trees a and b, with each
+// difference on a separate line in the format
+//
+//	path: value of a != value of b
+//
+// where path is the sequence of fields and indexes which leads from the
+// roots of the trees to the differing values. It returns an empty string
+// if the trees are equal.
+func (c Comparer) Diff(a, b Node) string {
+	var diffs strings.Builder
+	c.diff(&diffs, "Node", reflect.ValueOf(&a).Elem(), reflect.ValueOf(&b).Elem())
+	return diffs.String()
+}
+
+var positionType = reflect.TypeOf(token.Position{})
+
+func (c Comparer) diff(diffs *strings.Builder, path string, a, b reflect.Value) {
+	switch a.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		switch {
+		case a.IsNil() && b.IsNil():
+			return
+		case a.IsNil(), b.IsNil():
+			fmt.Fprintf(diffs, "%s: %s != %s\n", path, describe(a), describe(b))
+			return
+		}
+
+		if a.Kind() == reflect.Interface && a.Elem().Type() != b.Elem().Type() {
+			fmt.Fprintf(diffs, "%s: %s != %s\n", path, describe(a), describe(b))
+			return
+		}
+
+		c.diff(diffs, path, a.Elem(), b.Elem())
+
+	case reflect.Struct:
+		if a.Type() == positionType && !c.Positions {
+			return
+		}
+
+		for i := 0; i < a.NumField(); i++ {
+			name := a.Type().Field(i).Name
+			c.diff(diffs, path+"."+name, a.Field(i), b.Field(i))
+		}
+
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			fmt.Fprintf(diffs, "%s: len %d != len %d\n", path, a.Len(), b.Len())
+		}
+
+		for i := 0; i < a.Len() && i < b.Len(); i++ {
+			c.diff(diffs, fmt.Sprintf("%s[%d]", path, i), a.Index(i), b.Index(i))
+		}
+
+	default:
+		if a.Interface() != b.Interface() {
+			fmt.Fprintf(diffs, "%s: %s != %s\n", path, describe(a), describe(b))
+		}
+	}
+}
+
+// describe returns a short description of the value v which is used in
+// diffs. Nodes are described by their types.
+func describe(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return "nil"
+		}
+
+		if v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+
+		return v.Type().String()
+	case reflect.String:
+		return fmt.Sprintf("%q", v.Interface())
+	default:
+		return fmt.Sprintf("%v", v.Interface())
+	}
+}
@@ -0,0 +1,73 @@
+package ast_test
+
+import (
+	"testing"
+
+	"laptudirm.com/x/mash/pkg/ast"
+	"laptudirm.com/x/mash/pkg/token"
+)
+
+func TestEqual(t *testing.T) {
+	equal := []struct {
+		a, b string
+	}{
+		{"let x := 1 + 2\n", "let   x:=1+2 # sum\n"},
+		{"echo a | grep b\n", "echo a |\n\tgrep b\n"},
+		{"if x {\necho a\n}\n", "/* comment */ if x { echo a }\n"},
+	}
+
+	for _, test := range equal {
+		a, b := parse(t, test.a), parse(t, test.b)
+		if !ast.Equal(a, b) {
+			t.Errorf("%q and %q: expected equal trees, got diff:\n%s", test.a, test.b, ast.Diff(a, b))
+		}
+
+		// positions are different
+		if (ast.Comparer{Positions: true}).Equal(a, b) {
+			t.Errorf("%q and %q: expected positions to differ", test.a, test.b)
+		}
+	}
+
+	different := []struct {
+		a, b     string
+		expected string
+	}{
+		{
+			"let x := 1 + 2\n", "let x := 1 - 2\n",
+			"Node.Statements[0].Expression.Right.Operator.Type: + != -\n" +
+				"Node.Statements[0].Expression.Right.Operator.Literal: \"+\" != \"-\"\n",
+		},
+		{
+			"let x := 1\n", "let x := \"1\"\n",
+			"Node.Statements[0].Expression.Right: *ast.NumberLiteral != *ast.StringLiteral\n",
+		},
+		{
+			"echo a b\n", "echo a\n",
+			"Node.Statements[0].Command.Components: len 3 != len 2\n",
+		},
+		{
+			"for x {\n}\n", "for {\n}\n",
+			"Node.Statements[0].Condition: *ast.VariableExpression != nil\n",
+		},
+	}
+
+	for _, test := range different {
+		a, b := parse(t, test.a), parse(t, test.b)
+		if ast.Equal(a, b) {
+			t.Errorf("%q and %q: expected different trees", test.a, test.b)
+		}
+
+		if diff := ast.Diff(a, b); diff != test.expected {
+			t.Errorf("%q and %q: expected diff:\n%s\ngot:\n%s", test.a, test.b, test.expected, diff)
+		}
+	}
+
+	// positions are compared when requested
+	x := &ast.VariableExpression{Name: token.Token{Type: token.Identifier, Literal: "x"}}
+	y := &ast.VariableExpression{Name: token.Token{Type: token.Identifier, Literal: "x", Position: token.Position{Line: 2, Col: 3}}}
+
+	expected := "Node.Name.Position.Line: 0 != 2\nNode.Name.Position.Col: 0 != 3\n"
+	if diff := (ast.Comparer{Positions: true}).Diff(x, y); diff != expected {
+		t.Errorf("expected diff:\n%s\ngot:\n%s", expected, diff)
+	}
+}
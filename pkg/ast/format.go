@@ -0,0 +1,373 @@
+// Copyright © 2022 Rak Laptudirm <raklaptudirm@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"laptudirm.com/x/mash/pkg/token"
+)
+
+// Format returns the canonical mash source of node. Blocks are indented
+// with tabs, binary operators are surrounded by single spaces, and
+// parenthesis are added wherever the tree's structure requires them.
+// Comments are not a part of the tree, so they are not preserved.
+func Format(node Node) string {
+	var p printer
+	p.node(node)
+	return p.String()
+}
+
+// Precedences of expressions which are not binary expressions.
+const (
+	assignPrec  = 0 // assignments are only allowed at the top
+	lowestPrec  = 1 // any expression except assignments
+	unaryPrec   = 6 // unary expressions
+	primaryPrec = 7 // operands, calls, selectors, and indexes
+)
+
+// printer represents the state of a formatting operation.
+type printer struct {
+	strings.Builder
+	indent int // current indentation level
+}
+
+func (p *printer) node(node Node) {
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			p.stmt(stmt)
+			p.WriteByte('\n')
+		}
+	case *CaseClause:
+		p.clause(n)
+	case *ObjectEntry:
+		p.entry(n)
+	case Statement:
+		p.stmt(n)
+	case Expression:
+		p.expr(n, assignPrec)
+	case Command:
+		p.cmd(n)
+	}
+}
+
+func (p *printer) writeIndent() {
+	for i := 0; i < p.indent; i++ {
+		p.WriteByte('\t')
+	}
+}
+
+// stmts prints each of stmts on a separate line, one level deeper than the
+// current indentation.
+func (p *printer) stmts(stmts []Statement) {
+	p.indent++
+	for _, stmt := range stmts {
+		p.writeIndent()
+		p.stmt(stmt)
+		p.WriteByte('\n')
+	}
+	p.indent--
+}
+
+func (p *printer) block(block *BlockStatement) {
+	if len(block.Statements) == 0 {
+		p.WriteString("{}")
+		return
+	}
+
+	p.WriteString("{\n")
+	p.stmts(block.Statements)
+	p.writeIndent()
+	p.WriteByte('}')
+}
+
+func (p *printer) stmt(stmt Statement) {
+	switch s := stmt.(type) {
+	case *BlockStatement:
+		p.block(s)
+	case *IfStatement:
+		p.WriteString("if ")
+		p.expr(s.Condition, lowestPrec)
+		p.WriteByte(' ')
+		p.block(s.BlockStmt)
+
+		if s.ElseBlock != nil {
+			p.WriteString(" else ")
+			p.stmt(s.ElseBlock)
+		}
+	case *ForStatement:
+		p.WriteString("for ")
+		if s.Condition != nil {
+			p.expr(s.Condition, lowestPrec)
+			p.WriteByte(' ')
+		}
+
+		p.block(s.BlockStmt)
+	case *SwitchStatement:
+		p.WriteString("switch ")
+		p.expr(s.Subject, lowestPrec)
+
+		if len(s.Clauses) == 0 {
+			p.WriteString(" {}")
+			return
+		}
+
+		p.WriteString(" {\n")
+		for _, clause := range s.Clauses {
+			p.writeIndent()
+			p.clause(clause)
+		}
+
+		p.writeIndent()
+		p.WriteByte('}')
+	case *LetStatement:
+		p.WriteString("let ")
+		p.expr(s.Expression, assignPrec)
+	case *CmdStatement:
+		p.cmd(s.Command)
+	}
+}
+
+func (p *printer) clause(clause *CaseClause) {
+	if clause.Values == nil {
+		p.WriteString("default:\n")
+	} else {
+		p.WriteString("case ")
+		p.exprList(clause.Values)
+		p.WriteString(":\n")
+	}
+
+	p.stmts(clause.Statements)
+}
+
+// exprPrec returns the precedence of expr.
+func exprPrec(expr Expression) int {
+	switch e := expr.(type) {
+	case *AssignExpression:
+		return assignPrec
+	case *LogicalExpression:
+		return e.Operator.Type.Precedence()
+	case *BinaryExpression:
+		return e.Operator.Type.Precedence()
+	case *UnaryExpression:
+		return unaryPrec
+	default:
+		return primaryPrec
+	}
+}
+
+// expr prints expr, surrounding it with parenthesis if it's precedence is
+// lower than prec.
+func (p *printer) expr(expr Expression, prec int) {
+	if exprPrec(expr) < prec {
+		p.WriteByte('(')
+		p.expr(expr, assignPrec)
+		p.WriteByte(')')
+		return
+	}
+
+	switch e := expr.(type) {
+	case *AssignExpression:
+		p.expr(e.Left, lowestPrec)
+		p.WriteString(" " + e.Operator.Type.String() + " ")
+		p.expr(e.Right, lowestPrec)
+	case *LogicalExpression:
+		p.binary(e.Left, e.Operator, e.Right)
+	case *BinaryExpression:
+		p.binary(e.Left, e.Operator, e.Right)
+	case *UnaryExpression:
+		p.WriteString(e.Operator.Type.String())
+		p.expr(e.Right, primaryPrec)
+	case *GroupExpression:
+		p.WriteByte('(')
+		p.expr(e.Right, lowestPrec)
+		p.WriteByte(')')
+	case *CallExpression:
+		p.expr(e.Callee, primaryPrec)
+		p.WriteByte('(')
+		p.exprList(e.Arguments)
+		p.WriteByte(')')
+	case *GetExpression:
+		p.expr(e.Expr, primaryPrec)
+		p.WriteByte('[')
+		p.expr(e.Name, lowestPrec)
+		p.WriteByte(']')
+	case *SelectorExpression:
+		p.expr(e.Name, primaryPrec)
+		p.WriteByte('.')
+		p.WriteString(e.Index.Literal)
+	case *VariableExpression:
+		p.WriteString(e.Name.Literal)
+	case *NumberLiteral:
+		if e.Token.Literal != "" {
+			p.WriteString(e.Token.Literal)
+			break
+		}
+
+		p.WriteString(strconv.FormatFloat(e.Value, 'g', -1, 64))
+	case *StringLiteral:
+		if e.Token.Literal != "" {
+			p.WriteString(e.Token.Literal)
+			break
+		}
+
+		p.WriteString(strconv.Quote(e.Value))
+	case *FunctionLiteral:
+		p.WriteString("func ")
+		p.block(e.Block)
+	case *ArrayLiteral:
+		p.WriteByte('[')
+		p.exprList(e.Elements)
+		p.WriteByte(']')
+	case *ObjectLiteral:
+		p.WriteString("obj[")
+		for i, entry := range e.Elements {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+
+			p.entry(entry)
+		}
+		p.WriteByte(']')
+	case *TemplateLiteral:
+		p.template(e)
+	}
+}
+
+// binary prints a binary or logical expression. Binary operators are left
+// associative, so the right operand is parenthesized if it's precedence is
+// the same as the operator's.
+func (p *printer) binary(left Expression, op token.Token, right Expression) {
+	prec := op.Type.Precedence()
+
+	p.expr(left, prec)
+	p.WriteString(" " + op.Type.String() + " ")
+	p.expr(right, prec+1)
+}
+
+func (p *printer) exprList(list []Expression) {
+	for i, expr := range list {
+		if i > 0 {
+			p.WriteString(", ")
+		}
+
+		p.expr(expr, lowestPrec)
+	}
+}
+
+func (p *printer) entry(entry *ObjectEntry) {
+	p.expr(entry.Key, lowestPrec)
+	p.WriteString(": ")
+	p.expr(entry.Value, lowestPrec)
+}
+
+func (p *printer) template(t *TemplateLiteral) {
+	p.WriteByte('\'')
+	for i, component := range t.Components {
+		p.WriteString(component.Literal)
+
+		if i < len(t.Expressions) {
+			p.WriteByte('{')
+			p.expr(t.Expressions[i], lowestPrec)
+			p.WriteByte('}')
+		}
+	}
+	p.WriteByte('\'')
+}
+
+func (p *printer) cmd(cmd Command) {
+	switch c := cmd.(type) {
+	case *LogicalCommand:
+		p.cmd(c.Left)
+		p.WriteString(" " + c.Operator.Type.String() + " ")
+		p.cmd(c.Right)
+	case *BinaryCommand:
+		p.cmd(c.Left)
+		p.WriteString(" " + c.Operator.Type.String() + " ")
+		p.cmd(c.Right)
+	case *UnaryCommand:
+		p.WriteString(c.Operator.Type.String() + " ")
+		p.cmd(c.Right)
+	case *SubshellCommand:
+		p.subshell(c)
+	case *LiteralCommand:
+		for i, component := range c.Components {
+			if i > 0 {
+				p.WriteByte(' ')
+			}
+
+			switch c := component.(type) {
+			case *StringLiteral:
+				p.word(c)
+			case *TemplateLiteral:
+				p.template(c)
+			}
+		}
+	}
+}
+
+// subshell prints a subshell on a single line if it only contains command
+// statements, otherwise it is printed like a block.
+func (p *printer) subshell(s *SubshellCommand) {
+	for _, stmt := range s.Statements {
+		if _, ok := stmt.(*CmdStatement); !ok {
+			p.WriteString("(\n")
+			p.stmts(s.Statements)
+			p.writeIndent()
+			p.WriteByte(')')
+			return
+		}
+	}
+
+	p.WriteByte('(')
+	for i, stmt := range s.Statements {
+		if i > 0 {
+			p.WriteString("; ")
+		}
+
+		p.stmt(stmt)
+	}
+	p.WriteByte(')')
+}
+
+// word prints a command word. Words which were not parsed from source are
+// printed with their special runes escaped, including the '}' which closes
+// blocks and the '/' of a leading "/*", which starts a comment, and empty
+// words are quoted so they aren't lost.
+func (p *printer) word(word *StringLiteral) {
+	switch {
+	case word.Token.Literal != "":
+		p.WriteString(word.Token.Literal)
+		return
+	case word.Value == "":
+		p.WriteString(`""`)
+		return
+	}
+
+	if strings.HasPrefix(word.Value, "/*") {
+		p.WriteByte('\\')
+	}
+
+	for _, r := range word.Value {
+		switch {
+		case unicode.IsSpace(r), strings.ContainsRune("\\|&!#;(){}\"'`", r):
+			p.WriteByte('\\')
+		}
+
+		p.WriteRune(r)
+	}
+}
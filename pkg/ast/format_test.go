@@ -0,0 +1,179 @@
+package ast_test
+
+import (
+	"testing"
+
+	"laptudirm.com/x/mash/pkg/ast"
+	"laptudirm.com/x/mash/pkg/lexer"
+	"laptudirm.com/x/mash/pkg/parser"
+	"laptudirm.com/x/mash/pkg/token"
+)
+
+// parse parses src and fails the test if any errors are reported.
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+
+	handler := func(pos token.Position, err error) {
+		t.Errorf("%q: %s: %v", src, &pos, err)
+	}
+
+	return parser.Parse(lexer.Lex(src, handler), handler)
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let   x:=1+2*  3\n", "let x := 1 + 2 * 3\n"},
+		{"let x = (1+2)*3\n", "let x = (1 + 2) * 3\n"},
+		{"let a.b[c] += -f(d,e)\n", "let a.b[c] += -f(d, e)\n"},
+		{"let x := f(a\n, [b\n])\n", "let x := f(a, [b])\n"},
+		{"let x := a||b&&c == d\n", "let x := a || b && c == d\n"},
+		{"let o := obj[ \"a\":1,b:[2,3], ]\n", "let o := obj[\"a\": 1, b: [2, 3]]\n"},
+		{"let s := 'x {y+1} z'\n", "let s := 'x {y + 1} z'\n"},
+		{"let f := func {\necho   hi\n}\n", "let f := func {\n\techo hi\n}\n"},
+		{"let f := func {}\n", "let f := func {}\n"},
+		{"echo a\\ b   \"c d\" |grep x  && ! false ||true\n", "echo a\\ b \"c d\" | grep x && ! false || true\n"},
+		{
+			"if x==1 {\necho one\n} else if x {\nfor y {\necho two\n}\n} else {\nfor {\n}\n}\n",
+			"if x == 1 {\n\techo one\n} else if x {\n\tfor y {\n\t\techo two\n\t}\n} else {\n\tfor {}\n}\n",
+		},
+		{
+			"switch x {\ncase 1,2:\necho a\ndefault:\n}\n",
+			"switch x {\ncase 1, 2:\n\techo a\ndefault:\n}\n",
+		},
+		{"# comment\nlet x /* c */ := 1\n", "let x := 1\n"},
+		{"(cd /tmp ;echo a)|| ( echo b )\n", "(cd /tmp; echo a) || (echo b)\n"},
+		{"(let x := 1\necho x)\n", "(\n\tlet x := 1\n\techo x\n)\n"},
+	}
+
+	for _, test := range tests {
+		formatted := ast.Format(parse(t, test.input))
+		if formatted != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, formatted)
+			continue
+		}
+
+		// formatting should be stable
+		if again := ast.Format(parse(t, formatted)); again != formatted {
+			t.Errorf("%q: formatting is not stable, got %q then %q", test.input, formatted, again)
+		}
+	}
+}
+
+func TestFormatPrecedence(t *testing.T) {
+	variable := func(name string) ast.Expression {
+		return &ast.VariableExpression{
+			Name: token.Token{Type: token.Identifier, Literal: name},
+		}
+	}
+
+	binary := func(left ast.Expression, op token.Type, right ast.Expression) ast.Expression {
+		return &ast.BinaryExpression{
+			Left:     left,
+			Operator: token.Token{Type: op, Literal: op.String()},
+			Right:    right,
+		}
+	}
+
+	tests := []struct {
+		expr     ast.Expression
+		expected string
+	}{
+		{binary(binary(variable("a"), token.Addition, variable("b")), token.Multiplication, variable("c")), "(a + b) * c"},
+		{binary(variable("a"), token.Subtraction, binary(variable("b"), token.Subtraction, variable("c"))), "a - (b - c)"},
+		{binary(binary(variable("a"), token.Subtraction, variable("b")), token.Subtraction, variable("c")), "a - b - c"},
+		{&ast.UnaryExpression{
+			Operator: token.Token{Type: token.Not, Literal: "!"},
+			Right:    binary(variable("a"), token.Equal, variable("b")),
+		}, "!(a == b)"},
+		{&ast.CallExpression{
+			Callee:    binary(variable("f"), token.Or, variable("g")),
+			Arguments: []ast.Expression{&ast.NumberLiteral{Value: 1.5}, &ast.StringLiteral{Value: "a\"b"}},
+		}, `(f | g)(1.5, "a\"b")`},
+	}
+
+	for i, test := range tests {
+		if formatted := ast.Format(test.expr); formatted != test.expected {
+			t.Errorf("case %v: expected %q, got %q", i, test.expected, formatted)
+		}
+	}
+
+	words := []struct {
+		value    string
+		expected string
+	}{
+		{"a b|c", `echo a\ b\|c`},
+		{"a;b", `echo a\;b`},
+		{"(x)", `echo \(x\)`},
+		{"a)b", `echo a\)b`},
+		{"", `echo ""`},
+		{"}", `echo \}`},
+		{"{a}", `echo \{a\}`},
+		{"/*a", `echo \/*a`},
+	}
+
+	// roundTrip checks that the command in src, at the top level or inside
+	// a block, parses to the words in expected.
+	roundTrip := func(src string, expected ...string) {
+		for _, src := range []string{src + "\n", "if x {\n\t" + src + "\n}\n"} {
+			program := parse(t, src)
+			if len(program.Statements) != 1 {
+				t.Errorf("%q: expected 1 statement, got %d", src, len(program.Statements))
+				continue
+			}
+
+			stmt := program.Statements[0]
+			if block, ok := stmt.(*ast.IfStatement); ok {
+				if len(block.BlockStmt.Statements) != 1 {
+					t.Errorf("%q: expected 1 statement in block, got %d", src, len(block.BlockStmt.Statements))
+					continue
+				}
+
+				stmt = block.BlockStmt.Statements[0]
+			}
+
+			cmd, ok := stmt.(*ast.CmdStatement)
+			if !ok {
+				t.Errorf("%q: expected *ast.CmdStatement, got %T", src, stmt)
+				continue
+			}
+
+			literal, ok := cmd.Command.(*ast.LiteralCommand)
+			if !ok || len(literal.Components) != len(expected) {
+				t.Errorf("%q: expected a command with %d words, got %s", src, len(expected), ast.Format(cmd.Command))
+				continue
+			}
+
+			for i, component := range literal.Components {
+				if word, ok := component.(*ast.StringLiteral); !ok || word.Value != expected[i] {
+					t.Errorf("%q: expected word %q, got %#v", src, expected[i], component)
+				}
+			}
+		}
+	}
+
+	word := func(value string) *ast.StringLiteral {
+		return &ast.StringLiteral{Value: value}
+	}
+
+	for _, test := range words {
+		cmd := &ast.LiteralCommand{
+			Components: []ast.CommandComponent{word("echo"), word(test.value)},
+		}
+
+		formatted := ast.Format(cmd)
+		if formatted != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.value, test.expected, formatted)
+			continue
+		}
+
+		// the formatted command must parse back to the same words, with
+		// the word as an argument and as the command's name
+		roundTrip(formatted, "echo", test.value)
+
+		cmd.Components = []ast.CommandComponent{word(test.value), word("x")}
+		roundTrip(ast.Format(cmd), test.value, "x")
+	}
+}
@@ -55,12 +55,20 @@ func (a *ArrayLiteral) Expression() {}
 // ObjectLiteral node represents an object expression.
 type ObjectLiteral struct {
 	Token    token.Token
-	Elements map[Expression]Expression
+	Elements []*ObjectEntry
 }
 
 func (o *ObjectLiteral) Node()       {}
 func (o *ObjectLiteral) Expression() {}
 
+// ObjectEntry node represents a key-value entry of an object expression.
+type ObjectEntry struct {
+	Key   Expression
+	Value Expression
+}
+
+func (o *ObjectEntry) Node() {}
+
 // TemplateLiteral node represents a template string expression.
 type TemplateLiteral struct {
 	Expressions []Expression
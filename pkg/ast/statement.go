@@ -46,6 +46,24 @@ type ForStatement struct {
 func (f *ForStatement) Node()      {}
 func (f *ForStatement) Statement() {}
 
+// SwitchStatement represents a switch conditional statement.
+type SwitchStatement struct {
+	Subject Expression
+	Clauses []*CaseClause
+}
+
+func (s *SwitchStatement) Node()      {}
+func (s *SwitchStatement) Statement() {}
+
+// CaseClause represents a case or default clause of a switch statement.
+// The Values of a default clause are nil.
+type CaseClause struct {
+	Values     []Expression
+	Statements []Statement
+}
+
+func (c *CaseClause) Node() {}
+
 // LetStatement represents a let expression statement.
 type LetStatement struct {
 	Expression Expression
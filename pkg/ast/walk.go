@@ -0,0 +1,152 @@
+// Copyright © 2022 Rak Laptudirm <raklaptudirm@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children of
+// node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an abstract syntax tree in depth-first order, starting
+// with a call to v.Visit(node). The children of a node are visited in the
+// order they appear in the source.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStmts(v, n.Statements)
+
+	// statements
+	case *BlockStatement:
+		walkStmts(v, n.Statements)
+	case *IfStatement:
+		Walk(v, n.Condition)
+		Walk(v, n.BlockStmt)
+		if n.ElseBlock != nil {
+			Walk(v, n.ElseBlock)
+		}
+	case *ForStatement:
+		if n.Condition != nil {
+			Walk(v, n.Condition)
+		}
+		Walk(v, n.BlockStmt)
+	case *SwitchStatement:
+		Walk(v, n.Subject)
+		for _, clause := range n.Clauses {
+			Walk(v, clause)
+		}
+	case *CaseClause:
+		walkExprs(v, n.Values)
+		walkStmts(v, n.Statements)
+	case *LetStatement:
+		Walk(v, n.Expression)
+	case *CmdStatement:
+		Walk(v, n.Command)
+
+	// expressions
+	case *AssignExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *LogicalExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *BinaryExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *UnaryExpression:
+		Walk(v, n.Right)
+	case *GroupExpression:
+		Walk(v, n.Right)
+	case *CallExpression:
+		Walk(v, n.Callee)
+		walkExprs(v, n.Arguments)
+	case *GetExpression:
+		Walk(v, n.Expr)
+		Walk(v, n.Name)
+	case *SelectorExpression:
+		Walk(v, n.Name)
+	case *VariableExpression:
+		// nothing to do
+
+	// literals
+	case *NumberLiteral, *StringLiteral:
+		// nothing to do
+	case *FunctionLiteral:
+		Walk(v, n.Block)
+	case *ArrayLiteral:
+		walkExprs(v, n.Elements)
+	case *ObjectLiteral:
+		for _, entry := range n.Elements {
+			Walk(v, entry)
+		}
+	case *ObjectEntry:
+		Walk(v, n.Key)
+		Walk(v, n.Value)
+	case *TemplateLiteral:
+		walkExprs(v, n.Expressions)
+
+	// commands
+	case *LogicalCommand:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *BinaryCommand:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *UnaryCommand:
+		Walk(v, n.Right)
+	case *SubshellCommand:
+		walkStmts(v, n.Statements)
+	case *LiteralCommand:
+		for _, component := range n.Components {
+			Walk(v, component)
+		}
+	}
+
+	v.Visit(nil)
+}
+
+func walkStmts(v Visitor, stmts []Statement) {
+	for _, stmt := range stmts {
+		Walk(v, stmt)
+	}
+}
+
+func walkExprs(v Visitor, exprs []Expression) {
+	for _, expr := range exprs {
+		Walk(v, expr)
+	}
+}
+
+// inspector implements Visitor using a function.
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+
+	return nil
+}
+
+// Inspect traverses an abstract syntax tree in depth-first order, starting
+// with a call to f(node). If f returns true, Inspect invokes f recursively
+// for each of the children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
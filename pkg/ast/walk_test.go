@@ -0,0 +1,78 @@
+package ast_test
+
+import (
+	"testing"
+
+	"laptudirm.com/x/mash/pkg/ast"
+)
+
+func TestInspect(t *testing.T) {
+	program := parse(t, `echo a | grep b
+let f := func {
+	if x {
+		(echo c && echo d)
+	}
+}
+for {
+	echo 'e {f(g)}'
+}
+`)
+
+	commands := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if _, ok := node.(*ast.LiteralCommand); ok {
+			commands++
+		}
+
+		return true
+	})
+
+	if commands != 5 {
+		t.Errorf("expected 5 literal commands, got %d", commands)
+	}
+
+	// stop at the first call expression
+	var calls, nodes int
+	ast.Inspect(parse(t, "let x := f(a) + g(b)\n"), func(node ast.Node) bool {
+		if calls > 0 {
+			return false
+		}
+
+		if node != nil {
+			nodes++
+		}
+
+		if _, ok := node.(*ast.CallExpression); ok {
+			calls++
+			return false
+		}
+
+		return true
+	})
+
+	if calls != 1 {
+		t.Errorf("expected inspection to stop at the first call, got %d calls", calls)
+	}
+
+	// program, let, assignment, x, addition, and the call
+	if nodes != 6 {
+		t.Errorf("expected 6 nodes before stopping, got %d", nodes)
+	}
+
+	// subtrees are skipped when f returns false
+	commands = 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.LiteralCommand:
+			commands++
+		case *ast.FunctionLiteral:
+			return false
+		}
+
+		return true
+	})
+
+	if commands != 3 {
+		t.Errorf("expected 3 literal commands outside functions, got %d", commands)
+	}
+}
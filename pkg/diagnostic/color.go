@@ -0,0 +1,53 @@
+// Copyright © 2022 Rak Laptudirm <raklaptudirm@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostic
+
+import "os"
+
+// Color reports whether diagnostics are rendered with ANSI color escapes.
+// It defaults to ColorEnabled(os.Stdout), and can be overridden by the
+// user, like with a --no-color flag.
+var Color = ColorEnabled(os.Stdout)
+
+// Various ANSI color codes used by colorize.
+const (
+	bold = "1"
+	red  = "1;31"
+)
+
+// ColorEnabled reports whether colored output should be written to f.
+// Colors are disabled if the NO_COLOR environment variable is set to a non
+// empty value, or if f is not a terminal.
+func ColorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps s in the ANSI escapes of the color code. It returns s
+// unchanged if Color is false.
+func colorize(s, code string) string {
+	if !Color {
+		return s
+	}
+
+	return "\u001b[" + code + "m" + s + "\u001b[0m"
+}
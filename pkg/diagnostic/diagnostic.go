@@ -0,0 +1,94 @@
+// Copyright © 2022 Rak Laptudirm <raklaptudirm@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diagnostic implements the collection and formatting of errors
+// reported by the lexer and the parser.
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"laptudirm.com/x/mash/pkg/token"
+)
+
+// Diagnostic represents a single error reported at a position in the
+// source.
+type Diagnostic struct {
+	Position token.Position
+	Message  string
+}
+
+// MarshalJSON encodes d as an object with the line, col, and message
+// fields.
+func (d Diagnostic) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Line    int    `json:"line"`
+		Col     int    `json:"col"`
+		Message string `json:"message"`
+	}{
+		Line:    d.Position.Line,
+		Col:     d.Position.Col,
+		Message: d.Message,
+	})
+}
+
+// List represents a list of diagnostics, in the order they were reported.
+type List []Diagnostic
+
+// Add appends a diagnostic with the position pos and the message of err to
+// l. It's signature matches lexer.ErrorHandler, so l.Add can be used as the
+// error handler of the lexer or the parser. Add is not safe for concurrent
+// use, and since the lexer runs in it's own goroutine, the lexer and the
+// parser should be given different lists.
+func (l *List) Add(pos token.Position, err error) {
+	*l = append(*l, Diagnostic{
+		Position: pos,
+		Message:  err.Error(),
+	})
+}
+
+// Format represents an output format of diagnostics.
+type Format string
+
+// Various formats supported by FormatDiagnostics.
+const (
+	Text Format = "text" // line:col: message
+	JSON Format = "json" // {"line":N,"col":M,"message":"..."}
+)
+
+// FormatDiagnostics formats diags using format, writing one diagnostic per
+// line. It returns an error if format is not a supported format.
+func FormatDiagnostics(diags List, format Format) (string, error) {
+	var b strings.Builder
+
+	for _, d := range diags {
+		switch format {
+		case Text:
+			fmt.Fprintf(&b, "%s: %s\n", &d.Position, d.Message)
+		case JSON:
+			line, err := json.Marshal(d)
+			if err != nil {
+				return "", err
+			}
+
+			b.Write(line)
+			b.WriteByte('\n')
+		default:
+			return "", fmt.Errorf("unknown diagnostic format %q", format)
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,145 @@
+package diagnostic_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"laptudirm.com/x/mash/pkg/diagnostic"
+	"laptudirm.com/x/mash/pkg/lexer"
+	"laptudirm.com/x/mash/pkg/parser"
+	"laptudirm.com/x/mash/pkg/token"
+)
+
+func TestFormatDiagnostics(t *testing.T) {
+	diags := diagnostic.List{
+		{Position: token.Position{Line: 1, Col: 5}, Message: "unexpected EOF"},
+		{Position: token.Position{Line: 3, Col: 1}, Message: `illegal token "}"`},
+	}
+
+	tests := []struct {
+		format   diagnostic.Format
+		expected string
+	}{
+		{diagnostic.Text, "1:5: unexpected EOF\n3:1: illegal token \"}\"\n"},
+		{diagnostic.JSON, `{"line":1,"col":5,"message":"unexpected EOF"}` + "\n" + `{"line":3,"col":1,"message":"illegal token \"}\""}` + "\n"},
+	}
+
+	for _, test := range tests {
+		out, err := diagnostic.FormatDiagnostics(diags, test.format)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", test.format, err)
+		}
+
+		if out != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.format, test.expected, out)
+		}
+	}
+
+	if _, err := diagnostic.FormatDiagnostics(diags, "xml"); err == nil {
+		t.Errorf("xml: expected error, got nil")
+	}
+}
+
+func TestListAdd(t *testing.T) {
+	var lexErrs, diags diagnostic.List
+
+	src := "let (1\n"
+	parser.Parse(lexer.Lex(src, lexErrs.Add), diags.Add)
+	diags = append(lexErrs, diags...)
+
+	if len(diags) == 0 {
+		t.Fatalf("expected diagnostics, got none")
+	}
+
+	out, err := diagnostic.FormatDiagnostics(diags, diagnostic.JSON)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	for i, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		var d struct {
+			Line    int
+			Col     int
+			Message string
+		}
+
+		if err := json.Unmarshal([]byte(line), &d); err != nil {
+			t.Fatalf("diagnostic %d: invalid json %q: %v", i, line, err)
+		}
+
+		if d.Line != diags[i].Position.Line || d.Col != diags[i].Position.Col {
+			t.Errorf("diagnostic %d: expected position %s, got %d:%d", i, &diags[i].Position, d.Line, d.Col)
+		}
+		if d.Message != diags[i].Message {
+			t.Errorf("diagnostic %d: expected message %q, got %q", i, diags[i].Message, d.Message)
+		}
+	}
+
+	diags = nil
+	diags.Add(token.Position{Line: 2, Col: 4}, errors.New("error"))
+	if len(diags) != 1 || diags[0].Position.Line != 2 || diags[0].Position.Col != 4 {
+		t.Errorf("expected single diagnostic at 2:4, got %v", diags)
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	defer func(color bool) { diagnostic.Color = color }(diagnostic.Color)
+	diagnostic.Color = false
+
+	src := "echo a\n\tlet x (1\r\nlet y := 'é'"
+
+	tests := []struct {
+		pos      token.Position
+		expected string
+	}{
+		{token.Position{Line: 1, Col: 6}, "1:6: error\necho a\n     ^\n"},
+		{token.Position{Line: 2, Col: 8}, "2:8: error\n\tlet x (1\n\t      ^\n"},
+		{token.Position{Line: 3, Col: 11}, "3:11: error\nlet y := 'é'\n          ^\n"},
+		{token.Position{Line: 1, Col: 0}, "1:0: error\necho a\n^\n"},
+		{token.Position{Line: 1, Col: 20}, "1:20: error\necho a\n      ^\n"},
+		{token.Position{Line: 4, Col: 1}, "4:1: error\n"},
+		{token.Position{Line: 0, Col: 1}, "0:1: error\n"},
+	}
+
+	for _, test := range tests {
+		rendered := diagnostic.RenderError(src, test.pos, "error")
+		if rendered != test.expected {
+			t.Errorf("%s: expected %q, got %q", &test.pos, test.expected, rendered)
+		}
+	}
+}
+
+func TestColor(t *testing.T) {
+	defer func(color bool) { diagnostic.Color = color }(diagnostic.Color)
+
+	pos := token.Position{Line: 1, Col: 3}
+
+	diagnostic.Color = true
+	colored := diagnostic.RenderError("a b", pos, "error")
+	if expected := "\u001b[1m1:3: error\u001b[0m\na b\n  \u001b[1;31m^\u001b[0m\n"; colored != expected {
+		t.Errorf("expected %q, got %q", expected, colored)
+	}
+
+	diagnostic.Color = false
+	if plain := diagnostic.RenderError("a b", pos, "error"); strings.Contains(plain, "\u001b") {
+		t.Errorf("expected no color escapes, got %q", plain)
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if diagnostic.ColorEnabled(f) {
+		t.Errorf("expected color to be disabled for a regular file")
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if diagnostic.ColorEnabled(os.Stdout) {
+		t.Errorf("expected color to be disabled with NO_COLOR set")
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright © 2022 Rak Laptudirm <raklaptudirm@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostic
+
+import (
+	"fmt"
+	"strings"
+
+	"laptudirm.com/x/mash/pkg/token"
+)
+
+// RenderError renders the error msg at the position pos of src, followed by
+// the source line of the error and a caret under the error's column:
+//
+//	1:7: unexpected token (
+//	let x (1
+//	      ^
+//
+// Tabs before the column are kept in the caret's padding, so the caret is
+// aligned irrespective of the terminal's tab width. Columns outside the line
+// are clamped to it's start or the rune after it's end, and the source line
+// is omitted if pos.Line is not a line of src. The message and the caret
+// are colored if Color is true.
+func RenderError(src string, pos token.Position, msg string) string {
+	var b strings.Builder
+	b.WriteString(colorize(fmt.Sprintf("%s: %s", &pos, msg), bold))
+	b.WriteByte('\n')
+
+	lines := strings.Split(src, "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return b.String()
+	}
+
+	line := []rune(strings.TrimSuffix(lines[pos.Line-1], "\r"))
+
+	col := pos.Col
+	switch {
+	case col < 1:
+		col = 1
+	case col > len(line)+1:
+		col = len(line) + 1
+	}
+
+	b.WriteString(string(line))
+	b.WriteByte('\n')
+
+	for _, r := range line[:col-1] {
+		if r == '\t' {
+			b.WriteByte('\t')
+			continue
+		}
+
+		b.WriteByte(' ')
+	}
+
+	b.WriteString(colorize("^", red))
+	b.WriteByte('\n')
+	return b.String()
+}
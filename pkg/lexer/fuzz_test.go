@@ -0,0 +1,74 @@
+package lexer_test
+
+import (
+	"testing"
+	"time"
+
+	"laptudirm.com/x/mash/pkg/lexer"
+	"laptudirm.com/x/mash/pkg/token"
+)
+
+func FuzzLex(f *testing.F) {
+	seeds := []string{
+		"",
+		"# comment line\nfor\nif\nelse\n",
+		"let identifier\nlet 3141592653\nlet \"a string\"\n",
+		"let &^= <<= >>= && || := == != <= >=\n",
+		"let x := 0b_1010 + 0o17 + 0x_fF.8p-2 + 1e10\n",
+		"let x := 'template {a + 1} string'\n",
+		"let x := `raw\nstring`\n",
+		"echo a command\n||&&!|\n",
+		"echo a\\ b \\| \\$HOME\n",
+		"switch x {\ncase 1:\n\techo one\ndefault:\n\techo other\n}\n",
+		"let f := func {\n\techo hi\n}\n",
+		"let x := \"\\u00e9\\x41\\101\"\n",
+		"let café := 日本語\n",
+
+		// unterminated blocks and embedded expressions
+		"let {",
+		"let {\necho",
+		"let x := '{",
+		"let x := '{'",
+		"echo '{a",
+		"let x /* a /* b */",
+	}
+
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		for _, strict := range []bool{false, true} {
+			l := lexer.New(nil)
+			l.Strict = strict
+
+			tokens := l.Reset(src)
+			timeout := time.After(5 * time.Second)
+
+			var last token.Token
+			illegal := false // whether an illegal token was received
+		tokenLoop:
+			for {
+				select {
+				case tok, ok := <-tokens:
+					if !ok {
+						if last.Type != token.Eof {
+							t.Fatalf("%q: expected last token to be EOF, got %s", src, last)
+						}
+
+						break tokenLoop
+					}
+
+					if strict && illegal && tok.Type != token.Eof {
+						t.Fatalf("%q: expected strict lexer to stop after an illegal token, got %s", src, tok)
+					}
+
+					illegal = illegal || tok.Type == token.Illegal
+					last = tok
+				case <-timeout:
+					t.Fatalf("%q: lexer did not terminate", src)
+				}
+			}
+		}
+	})
+}
@@ -15,8 +15,12 @@ package lexer
 
 import (
 	"errors"
+	"strings"
+	"sync/atomic"
+	"unicode"
 	"unicode/utf8"
 
+	"golang.org/x/text/unicode/norm"
 	"laptudirm.com/x/mash/pkg/token"
 )
 
@@ -27,13 +31,34 @@ var (
 	ErrEnc = errors.New("illegal utf-8 encoding")
 )
 
-// lexer represents a mash source string and related lexing information.
-type lexer struct {
+// ErrBinary is reported instead of lexing a source which appears to be
+// binary data.
+var ErrBinary = errors.New("input appears to be binary")
+
+// Lexer represents a mash source string and related lexing information. A
+// Lexer can be reused to lex multiple sources using Reset.
+type Lexer struct {
 	src string // source string
 	ch  rune   // current character
 	wd  int    // character width
 
+	canBackup bool // whether the current rune can be backed up
+
+	// Normalize enables the normalization of identifiers and command words
+	// to Unicode NFC, so that the composed and decomposed forms of a word
+	// lex to the same literal. It is disabled by default since it changes
+	// words like path arguments.
+	Normalize bool
+
+	// Strict makes the lexer stop at the first illegal token, emitting an
+	// EOF token right after it.
+	Strict bool
+
 	insertSemi bool
+	clause     bool // lexing a case clause header
+	unclosed   bool // source ended inside a group
+	continued  bool // source ended with an operator continuing it's statement
+	subshells  int  // number of open subshells
 
 	Tokens TokenStream // lexer token channel
 
@@ -47,6 +72,8 @@ type lexer struct {
 	pos   token.Position // position in the source of the current rune
 
 	ErrCount int // number of errors encountered
+
+	stopped int32 // set by Reset to stop lexing, accessed atomically
 }
 
 const (
@@ -65,68 +92,203 @@ type TokenStream chan token.Token
 // returns the lexer's token channel.
 //
 func Lex(src string, err ErrorHandler) TokenStream {
+	return New(err).Reset(src)
+}
+
+// New returns a new Lexer which uses err to handle any lexer errors. The
+// returned Lexer starts lexing when Reset is called.
+func New(err ErrorHandler) *Lexer {
+	return &Lexer{
+		err: err,
+	}
+}
+
+// Reset clears the positions, offsets, and error count of l and starts the
+// lexing of src, returning the lexer's new token channel. If l is still
+// lexing a source, Reset stops it without reporting any more errors, so the
+// previous token channel doesn't need to be drained, like when a REPL
+// abandons a line.
+func (l *Lexer) Reset(src string) TokenStream {
+	l.init(src)
+	go l.run(l.lexProgram)
+
+	return l.Tokens
+}
+
+// LexExpr is like Lex, but lexes src as the body of a statement, so it can
+// be parsed as an expression with parser.ParseExpr. Unlike Lex, it never
+// lexes any part of src as a command, and sources which can only be one,
+// like cat file, are reported with ErrCommand so they can be run as commands.
+//
+func LexExpr(src string, err ErrorHandler) TokenStream {
+	l := New(err)
+	l.init(src)
+	go l.run(l.lexExpr)
+
+	return l.Tokens
+}
+
+// init stops l from lexing it's previous source, if any, and resets it to
+// the start of src.
+func (l *Lexer) init(src string) {
+	if l.Tokens != nil {
+		// stop lexing the previous source and wait for the lexer to
+		// finish, discarding the tokens it was emitting
+		atomic.StoreInt32(&l.stopped, 1)
+		for range l.Tokens {
+		}
+	}
+
 	origin := token.Position{
 		Line: 1,
 		Col:  1,
 	}
 
-	l := &lexer{
+	*l = Lexer{
 		src: src,
 
 		Tokens: make(TokenStream),
 
-		err: err,
+		err: l.err,
+
+		Normalize: l.Normalize,
+		Strict:    l.Strict,
 
 		start: origin,
 		pos:   origin,
 	}
-	go l.run()
-
-	return l.Tokens
 }
 
 // emit emits a token of type t with the current position and literal to
 // the lexer's token channel. It also resets the lexer position and offset
 // variables.
-func (l *lexer) emit(t token.Type) {
+func (l *Lexer) emit(t token.Type) {
+	l.emitLiteral(t, l.literal())
+}
+
+// emitWord is like emit, but normalizes the literal of the token if
+// l.Normalize is set. It is used for identifiers and command words.
+func (l *Lexer) emitWord(t token.Type) {
+	lit := l.literal()
+	if l.Normalize {
+		lit = norm.NFC.String(lit)
+	}
+
+	l.emitLiteral(t, lit)
+}
+
+// emitSemicolon emits the semicolon which ends a statement. It's literal
+// is the ';' or newline which ended the statement, with CRLF line endings
+// emitted as "\n", or empty at the end of the source.
+func (l *Lexer) emitSemicolon() {
+	lit := l.literal()
+	if lit == "\r\n" {
+		lit = "\n"
+	}
+
+	l.emitLiteral(token.Semicolon, lit)
+}
+
+// wordLiteral returns the literal of the command word being lexed. If
+// l.Normalize is set, the unquoted pieces of the word are normalized,
+// while the quoted pieces, whose start and end offsets are in quoted, are
+// left as they are, like other quoted strings.
+func (l *Lexer) wordLiteral(quoted []int) string {
+	if !l.Normalize {
+		return l.literal()
+	}
+
+	var b strings.Builder
+	piece := l.offset // start of the unquoted piece
+	for i := 0; i < len(quoted); i += 2 {
+		b.WriteString(norm.NFC.String(l.src[piece:quoted[i]]))
+		b.WriteString(l.src[quoted[i]:quoted[i+1]])
+		piece = quoted[i+1]
+	}
+
+	b.WriteString(norm.NFC.String(l.src[piece:l.rdOffset]))
+	return b.String()
+}
+
+// emitLiteral is like emit, but uses lit as the literal of the token.
+func (l *Lexer) emitLiteral(t token.Type, lit string) {
+	l.checkStopped()
+
 	l.Tokens <- token.Token{
 		Type:     t,
-		Literal:  l.literal(),
+		Literal:  lit,
 		Position: l.start,
 	}
 
 	l.ignore()
+
+	if t == token.Illegal && l.Strict {
+		// stop lexing at the first illegal token
+		l.emit(token.Eof)
+		panic(bailout{})
+	}
+}
+
+// bailout is used to unwind the lexer's states when it stops lexing early.
+type bailout struct{}
+
+// checkStopped stops the lexer if it has been stopped by Reset.
+func (l *Lexer) checkStopped() {
+	if atomic.LoadInt32(&l.stopped) != 0 {
+		panic(bailout{})
+	}
 }
 
 // error call's the lexer's error handler, if there is one, with the err
 // and the current position, and increases the lexer's ErrorCount by 1.
 //
-func (l *lexer) error(err error) {
+func (l *Lexer) error(err error) {
+	l.errorAt(l.pos, err)
+}
+
+// errorAt is like error, but reports err at the position pos.
+//
+func (l *Lexer) errorAt(pos token.Position, err error) {
+	l.checkStopped()
+
 	l.ErrCount++
 	if l.err != nil {
-		l.err(l.pos, err)
+		l.err(pos, err)
 	}
 }
 
-// peek returns the byte right after the current rune. It returns eof if
-// there are no more bytes after the current rune.
+// peek returns the rune right after the current rune. It returns eof if
+// there are no more runes after the current rune.
 //
-func (l *lexer) peek() rune {
+func (l *Lexer) peek() rune {
 	if l.atEnd() {
 		return eof
 	}
 
-	return rune(l.src[l.rdOffset])
+	r := rune(l.src[l.rdOffset])
+	if l.crlf() {
+		// \r\n is a single newline
+		r = '\n'
+	}
+
+	if r >= utf8.RuneSelf {
+		// decode multi-byte rune
+		r, _ = utf8.DecodeRuneInString(l.src[l.rdOffset:])
+	}
+
+	return r
 }
 
 // consume consumes the next rune, incresing rdOffset and pos by it's
 // width, and sets ch to the consumed rune. It sets ch to eof if it is at
-// the end of the source.
+// the end of the source. A \r\n line ending is consumed as a single '\n'.
 //
-func (l *lexer) consume() {
+func (l *Lexer) consume() {
 	if l.atEnd() {
 		l.ch = eof
 		l.wd = 0
+		l.prev = l.pos
+		l.canBackup = true
 		return
 	}
 
@@ -137,6 +299,12 @@ func (l *lexer) consume() {
 		goto advance
 	}
 
+	if l.crlf() {
+		// consume \r\n as a single newline
+		r, w = '\n', 2
+		goto advance
+	}
+
 	if r < utf8.RuneSelf {
 		// r is a single byte rune
 		goto advance
@@ -161,35 +329,99 @@ advance:
 	l.wd = w
 
 	l.prev = l.pos
+	l.canBackup = true
 
 	l.rdOffset += w
-	l.pos.Col += w
+	l.pos.Col++
 
 	if r == '\n' {
 		l.pos.NextLine()
 	}
 }
 
-func (l *lexer) backup() {
+// crlf checks if the source has a \r\n line ending at rdOffset.
+//
+func (l *Lexer) crlf() bool {
+	return strings.HasPrefix(l.src[l.rdOffset:], "\r\n")
+}
+
+// backup un-consumes the current rune. Like text/scanner, only a single
+// rune can be backed up, so backup panics if no rune has been consumed
+// since the previous backup or the start of the current token.
+//
+func (l *Lexer) backup() {
+	if !l.canBackup {
+		panic("lexer: backup without a consumed rune")
+	}
+
 	l.rdOffset -= l.wd
 	l.pos = l.prev
+	l.canBackup = false
+}
+
+// rewind un-consumes all the runes of the current token, moving back to
+// the start of the token.
+//
+func (l *Lexer) rewind() {
+	l.rdOffset = l.offset
+	l.pos = l.start
+	l.canBackup = false
 }
 
 // literal returns a sub-string from the source from offset to rdOffset.
 //
-func (l *lexer) literal() string {
+func (l *Lexer) literal() string {
 	return l.src[l.offset:l.rdOffset]
 }
 
 // ignore sets start to pos and offset to rdOffset.
 //
-func (l *lexer) ignore() {
+func (l *Lexer) ignore() {
 	l.offset = l.rdOffset
 	l.start = l.pos
+	l.canBackup = false
+}
+
+// follows checks if the source after the current rune starts with s.
+func (l *Lexer) follows(s string) bool {
+	return strings.HasPrefix(l.src[l.rdOffset:], s)
+}
+
+// binaryChunk is the size of the prefix of a source which is checked by
+// isBinary.
+const binaryChunk = 1024
+
+// isBinary checks if src appears to be binary data instead of text. A
+// source is considered binary if the first binaryChunk bytes contain a NUL
+// byte, or if more than a tenth of the runes in them are non printable.
+//
+func isBinary(src string) bool {
+	cut := len(src) > binaryChunk
+	if cut {
+		src = src[:binaryChunk]
+	}
+
+	runes, bad := 0, 0
+	for i, r := range src {
+		runes++
+
+		switch {
+		case r == 0:
+			return true
+		case r == utf8.RuneError && (!cut || len(src)-i >= utf8.UTFMax):
+			// encodings cut off by the chunk boundary might be valid, so
+			// they are only counted if the source wasn't truncated
+			bad++
+		case r < ' ' && !unicode.IsSpace(r), r == 0x7f:
+			bad++
+		}
+	}
+
+	return bad*10 > runes
 }
 
 // atEnd returns true if the rdOffset is greater than the length of the
 // source.
-func (l *lexer) atEnd() bool {
+func (l *Lexer) atEnd() bool {
 	return l.rdOffset >= len(l.src)
 }
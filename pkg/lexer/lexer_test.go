@@ -1,7 +1,10 @@
 package lexer_test
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"laptudirm.com/x/mash/pkg/lexer"
 	"laptudirm.com/x/mash/pkg/token"
@@ -86,138 +89,138 @@ echo a command
 `
 
 	tests := []struct {
-		expectedType    token.TokenType
+		expectedType    token.Type
 		expectedLiteral string
 		expectedLine    int
 		expectedCol     int
 	}{
-		{token.COMMENT, "# comment line", 1, 1},
-		{token.FOR, "for", 2, 1},
-		{token.IF, "if", 3, 1},
-		{token.ELIF, "elif", 4, 1},
-		{token.ELSE, "else", 5, 1},
-		{token.LET, "let", 7, 1},
-		{token.FUNC, "func", 8, 1},
-		{token.BREAK, "break", 10, 1},
-		{token.SEMICOLON, "\n", 10, 6},
-		{token.CONTINUE, "continue", 11, 1},
-		{token.SEMICOLON, "\n", 11, 9},
-		{token.RETURN, "return", 12, 1},
-		{token.SEMICOLON, "\n", 12, 7},
-		{token.LET, "let", 14, 1},
-		{token.IDENT, "identifier", 14, 5},
-		{token.SEMICOLON, "\n", 14, 15},
-		{token.LET, "let", 15, 1},
-		{token.FLOAT, "3141592653", 15, 5},
-		{token.SEMICOLON, "\n", 15, 15},
-		{token.LET, "let", 16, 1},
-		{token.STRING, "\"a string\"", 16, 5},
-		{token.SEMICOLON, "\n", 16, 15},
-		{token.COMMENT, "# line comment", 18, 1},
-		{token.LET, "let", 19, 1},
-		{token.IDENT, "i", 19, 5},
-		{token.COMMENT, "# inline", 19, 7},
-		{token.SEMICOLON, "\n", 19, 15},
-		{token.LET, "let", 21, 1},
-		{token.ADD, "+", 21, 5},
-		{token.LET, "let", 22, 1},
-		{token.SUB, "-", 22, 5},
-		{token.LET, "let", 23, 1},
-		{token.MUL, "*", 23, 5},
-		{token.LET, "let", 24, 1},
-		{token.QUO, "/", 24, 5},
-		{token.LET, "let", 25, 1},
-		{token.REM, "%", 25, 5},
-		{token.LET, "let", 27, 1},
-		{token.AND, "&", 27, 5},
-		{token.LET, "let", 28, 1},
-		{token.OR, "|", 28, 5},
-		{token.LET, "let", 29, 1},
-		{token.XOR, "^", 29, 5},
-		{token.LET, "let", 30, 1},
-		{token.SHL, "<<", 30, 5},
-		{token.LET, "let", 31, 1},
-		{token.SHR, ">>", 31, 5},
-		{token.LET, "let", 32, 1},
-		{token.AND_NOT, "&^", 32, 5},
-		{token.LET, "let", 34, 1},
-		{token.ADD_ASSIGN, "+=", 34, 5},
-		{token.LET, "let", 35, 1},
-		{token.SUB_ASSIGN, "-=", 35, 5},
-		{token.LET, "let", 36, 1},
-		{token.MUL_ASSIGN, "*=", 36, 5},
-		{token.LET, "let", 37, 1},
-		{token.QUO_ASSIGN, "/=", 37, 5},
-		{token.LET, "let", 38, 1},
-		{token.REM_ASSIGN, "%=", 38, 5},
-		{token.LET, "let", 40, 1},
-		{token.AND_ASSIGN, "&=", 40, 5},
-		{token.LET, "let", 41, 1},
-		{token.OR_ASSIGN, "|=", 41, 5},
-		{token.LET, "let", 42, 1},
-		{token.XOR_ASSIGN, "^=", 42, 5},
-		{token.LET, "let", 43, 1},
-		{token.SHL_ASSIGN, "<<=", 43, 5},
-		{token.LET, "let", 44, 1},
-		{token.SHR_ASSIGN, ">>=", 44, 5},
-		{token.LET, "let", 45, 1},
-		{token.AND_NOT_ASSIGN, "&^=", 45, 5},
-		{token.LET, "let", 47, 1},
-		{token.LAND, "&&", 47, 5},
-		{token.LET, "let", 48, 1},
-		{token.LOR, "||", 48, 5},
-		{token.LET, "let", 50, 1},
-		{token.EQL, "==", 50, 5},
-		{token.LET, "let", 51, 1},
-		{token.LSS, "<", 51, 5},
-		{token.LET, "let", 52, 1},
-		{token.GTR, ">", 52, 5},
-		{token.LET, "let", 53, 1},
-		{token.ASSIGN, "=", 53, 5},
-		{token.LET, "let", 54, 1},
-		{token.DEFINE, ":=", 54, 5},
-		{token.LET, "let", 55, 1},
-		{token.NOT, "!", 55, 5},
-		{token.LET, "let", 57, 1},
-		{token.NEQ, "!=", 57, 5},
-		{token.LET, "let", 58, 1},
-		{token.LEQ, "<=", 58, 5},
-		{token.LET, "let", 59, 1},
-		{token.GEQ, ">=", 59, 5},
-		{token.LET, "let", 61, 1},
-		{token.LPAREN, "(", 61, 5},
-		{token.LET, "let", 62, 1},
-		{token.LBRACK, "[", 62, 5},
-		{token.LET, "let", 63, 1},
-		{token.LBRACE, "{", 63, 5},
-		{token.LET, "let", 64, 1},
-		{token.COMMA, ",", 64, 5},
-		{token.LET, "let", 66, 1},
-		{token.RPAREN, ")", 66, 5},
-		{token.SEMICOLON, "\n", 66, 6},
-		{token.LET, "let", 67, 1},
-		{token.RBRACK, "]", 67, 5},
-		{token.SEMICOLON, "\n", 67, 6},
-		{token.LET, "let", 68, 1},
-		{token.SEMICOLON, "", 68, 5},
-		{token.RBRACE, "}", 68, 5},
-		{token.SEMICOLON, "\n", 68, 6},
-		{token.LET, "let", 69, 1},
-		{token.SEMICOLON, ";", 69, 5},
-		{token.LET, "let", 70, 1},
-		{token.COLON, ":", 70, 5},
-		{token.BREAK, "break", 72, 1},
-		{token.SEMICOLON, "\n", 72, 6},
-		{token.STRING, "echo", 74, 1},
-		{token.STRING, "a", 74, 6},
-		{token.STRING, "command", 74, 8},
-		{token.SEMICOLON, "\n", 74, 15},
-		{token.LOR, "||", 75, 1},
-		{token.LAND, "&&", 75, 3},
-		{token.NOT, "!", 75, 5},
-		{token.OR, "|", 75, 6},
-		{token.SEMICOLON, "\n", 75, 7},
-		{token.EOF, "", 76, 1},
+		{token.Comment, "# comment line", 1, 1},
+		{token.For, "for", 2, 1},
+		{token.If, "if", 3, 1},
+		{token.Identifier, "elif", 4, 1},
+		{token.Semicolon, "\n", 4, 5},
+		{token.Else, "else", 5, 1},
+		{token.Let, "let", 7, 1},
+		{token.Func, "func", 8, 1},
+		{token.Break, "break", 10, 1},
+		{token.Semicolon, "\n", 10, 6},
+		{token.Continue, "continue", 11, 1},
+		{token.Semicolon, "\n", 11, 9},
+		{token.Return, "return", 12, 1},
+		{token.Semicolon, "\n", 12, 7},
+		{token.Let, "let", 14, 1},
+		{token.Identifier, "identifier", 14, 5},
+		{token.Semicolon, "\n", 14, 15},
+		{token.Let, "let", 15, 1},
+		{token.Number, "3141592653", 15, 5},
+		{token.Semicolon, "\n", 15, 15},
+		{token.Let, "let", 16, 1},
+		{token.String, "\"a string\"", 16, 5},
+		{token.Semicolon, "\n", 16, 15},
+		{token.Comment, "# line comment", 18, 1},
+		{token.Let, "let", 19, 1},
+		{token.Identifier, "i", 19, 5},
+		{token.Comment, "# inline", 19, 7},
+		{token.Semicolon, "\n", 19, 15},
+		{token.Let, "let", 21, 1},
+		{token.Addition, "+", 21, 5},
+		{token.Let, "let", 22, 1},
+		{token.Subtraction, "-", 22, 5},
+		{token.Let, "let", 23, 1},
+		{token.Multiplication, "*", 23, 5},
+		{token.Let, "let", 24, 1},
+		{token.Quotient, "/", 24, 5},
+		{token.Let, "let", 25, 1},
+		{token.Remainder, "%", 25, 5},
+		{token.Let, "let", 27, 1},
+		{token.And, "&", 27, 5},
+		{token.Let, "let", 28, 1},
+		{token.Or, "|", 28, 5},
+		{token.Let, "let", 29, 1},
+		{token.Xor, "^", 29, 5},
+		{token.Let, "let", 30, 1},
+		{token.ShiftLeft, "<<", 30, 5},
+		{token.Let, "let", 31, 1},
+		{token.ShiftRight, ">>", 31, 5},
+		{token.Let, "let", 32, 1},
+		{token.AndNot, "&^", 32, 5},
+		{token.Let, "let", 34, 1},
+		{token.AdditionAssign, "+=", 34, 5},
+		{token.Let, "let", 35, 1},
+		{token.SubtractionAssign, "-=", 35, 5},
+		{token.Let, "let", 36, 1},
+		{token.MultiplicationAssign, "*=", 36, 5},
+		{token.Let, "let", 37, 1},
+		{token.QuotientAssign, "/=", 37, 5},
+		{token.Let, "let", 38, 1},
+		{token.RemainderAssign, "%=", 38, 5},
+		{token.Let, "let", 40, 1},
+		{token.AndAssign, "&=", 40, 5},
+		{token.Let, "let", 41, 1},
+		{token.OrAssign, "|=", 41, 5},
+		{token.Let, "let", 42, 1},
+		{token.XorAssign, "^=", 42, 5},
+		{token.Let, "let", 43, 1},
+		{token.ShiftLeftAssign, "<<=", 43, 5},
+		{token.Let, "let", 44, 1},
+		{token.ShiftRightAssign, ">>=", 44, 5},
+		{token.Let, "let", 45, 1},
+		{token.AndNotAssign, "&^=", 45, 5},
+		{token.Let, "let", 47, 1},
+		{token.LogicalAnd, "&&", 47, 5},
+		{token.Let, "let", 48, 1},
+		{token.LogicalOr, "||", 48, 5},
+		{token.Let, "let", 50, 1},
+		{token.Equal, "==", 50, 5},
+		{token.Let, "let", 51, 1},
+		{token.LessThan, "<", 51, 5},
+		{token.Let, "let", 52, 1},
+		{token.GreaterThan, ">", 52, 5},
+		{token.Let, "let", 53, 1},
+		{token.Assign, "=", 53, 5},
+		{token.Let, "let", 54, 1},
+		{token.Define, ":=", 54, 5},
+		{token.Let, "let", 55, 1},
+		{token.Not, "!", 55, 5},
+		{token.Let, "let", 57, 1},
+		{token.NotEqual, "!=", 57, 5},
+		{token.Let, "let", 58, 1},
+		{token.LessThanEqual, "<=", 58, 5},
+		{token.Let, "let", 59, 1},
+		{token.GreaterThanEqual, ">=", 59, 5},
+		{token.Let, "let", 61, 1},
+		{token.LeftParen, "(", 61, 5},
+		{token.Let, "let", 62, 1},
+		{token.LeftBrack, "[", 62, 5},
+		{token.Let, "let", 63, 1},
+		{token.LeftBrace, "{", 63, 5},
+		{token.Let, "let", 64, 1},
+		{token.Comma, ",", 64, 5},
+		{token.Let, "let", 66, 1},
+		{token.RightParen, ")", 66, 5},
+		{token.Semicolon, "\n", 66, 6},
+		{token.Let, "let", 67, 1},
+		{token.RightBrack, "]", 67, 5},
+		{token.Semicolon, "\n", 67, 6},
+		{token.Let, "let", 68, 1},
+		{token.Semicolon, "", 68, 5},
+		{token.RightBrace, "}", 68, 5},
+		// the parenthesis and bracket from lines 61 and 62 are never
+		// closed, so no more semicolons are inserted at newlines
+		{token.Let, "let", 69, 1},
+		{token.Semicolon, ";", 69, 5},
+		{token.Let, "let", 70, 1},
+		{token.Colon, ":", 70, 5},
+		{token.Break, "break", 72, 1},
+		{token.Identifier, "echo", 74, 1},
+		{token.Identifier, "a", 74, 6},
+		{token.Identifier, "command", 74, 8},
+		{token.LogicalOr, "||", 75, 1},
+		{token.LogicalAnd, "&&", 75, 3},
+		{token.Not, "!", 75, 5},
+		{token.Or, "|", 75, 6},
+		// nor at the end of the source
+		{token.Eof, "", 76, 1},
 	}
 
 	index := 0
@@ -239,3 +242,866 @@ echo a command
 	}
 
 }
+
+func TestLexerOperators(t *testing.T) {
+	// '{', '}', and '\'' are left out since they delimit blocks and
+	// template strings instead of lexing as standalone operators.
+	tests := []token.Type{
+		token.Addition,
+		token.Subtraction,
+		token.Multiplication,
+		token.Quotient,
+		token.Remainder,
+
+		token.And,
+		token.Or,
+		token.Xor,
+		token.ShiftLeft,
+		token.ShiftRight,
+		token.AndNot,
+
+		token.AdditionAssign,
+		token.SubtractionAssign,
+		token.MultiplicationAssign,
+		token.QuotientAssign,
+		token.RemainderAssign,
+
+		token.AndAssign,
+		token.OrAssign,
+		token.XorAssign,
+		token.ShiftLeftAssign,
+		token.ShiftRightAssign,
+		token.AndNotAssign,
+
+		token.LogicalAnd,
+		token.LogicalOr,
+
+		token.Equal,
+		token.LessThan,
+		token.GreaterThan,
+		token.Assign,
+		token.Define,
+		token.Not,
+
+		token.NotEqual,
+		token.LessThanEqual,
+		token.GreaterThanEqual,
+
+		token.LeftParen,
+		token.LeftBrack,
+		token.Comma,
+		token.Period,
+
+		token.RightParen,
+		token.RightBrack,
+		token.Semicolon,
+		token.Colon,
+	}
+
+	for _, test := range tests {
+		input := "let " + test.String()
+
+		var tokens []token.Token
+		for tok := range lexer.Lex(input, nil) {
+			tokens = append(tokens, tok)
+		}
+
+		if len(tokens) < 2 {
+			t.Fatalf("%q: expected at least 2 tokens, got %d", input, len(tokens))
+		}
+
+		op := tokens[1]
+		if op.Type != test {
+			t.Errorf("%q: expected token type %q, got %q", input, test, op.Type)
+		}
+		if op.Literal != test.String() {
+			t.Errorf("%q: expected token literal %q, got %q", input, test.String(), op.Literal)
+		}
+		if op.Position.Col != 5 {
+			t.Errorf("%q: expected token col 5, got %d", input, op.Position.Col)
+		}
+	}
+}
+
+func TestLexerEscapedWords(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`echo a\ b`, []string{"echo", `a\ b`}},
+		{`echo \| \& \! \;`, []string{"echo", `\|`, `\&`, `\!`, `\;`}},
+		{`echo a\|b \$HOME`, []string{"echo", `a\|b`, `\$HOME`}},
+		{`echo trailing\`, []string{"echo", `trailing\`}},
+		{`echo foo"bar baz"qux`, []string{"echo", `foo"bar baz"qux`}},
+		{"echo \"a\\\" b\"`c d`\\ e", []string{"echo", "\"a\\\" b\"`c d`\\ e"}},
+	}
+
+	for _, test := range tests {
+		var words []string
+		for tok := range lexer.Lex(test.input, nil) {
+			switch tok.Type {
+			case token.String:
+				words = append(words, tok.Literal)
+			case token.Semicolon, token.Eof:
+			default:
+				t.Errorf("%q: unexpected token %s", test.input, tok)
+			}
+		}
+
+		if len(words) != len(test.expected) {
+			t.Fatalf("%q: expected words %q, got %q", test.input, test.expected, words)
+		}
+
+		for i, word := range words {
+			if word != test.expected[i] {
+				t.Errorf("%q: expected word %q, got %q", test.input, test.expected[i], word)
+			}
+		}
+	}
+}
+
+func TestLexerReset(t *testing.T) {
+	inputs := []string{
+		"let x := \"unterminated\n",
+		"echo a command\n",
+		"let x := 0x_fF\n",
+	}
+
+	l := lexer.New(nil)
+	for _, input := range inputs {
+		var expected []token.Token
+		for tok := range lexer.Lex(input, nil) {
+			expected = append(expected, tok)
+		}
+
+		var tokens []token.Token
+		for tok := range l.Reset(input) {
+			tokens = append(tokens, tok)
+		}
+
+		if len(tokens) != len(expected) {
+			t.Fatalf("%q: expected %d tokens, got %d", input, len(expected), len(tokens))
+		}
+
+		for i, tok := range tokens {
+			if tok != expected[i] {
+				t.Errorf("%q: expected token %s, got %s", input, expected[i], tok)
+			}
+		}
+	}
+
+	l.Reset("echo\n")
+	if l.ErrCount != 0 {
+		t.Errorf("expected error count to be reset, got %d", l.ErrCount)
+	}
+}
+
+func TestLexerResetUndrained(t *testing.T) {
+	count := 0
+	l := lexer.New(func(token.Position, error) {
+		count++
+	})
+
+	// abandon the source after it's first token, before the lexer
+	// reaches the illegal rune
+	<-l.Reset("echo a\nlet x := $\n")
+
+	done := make(chan []token.Type)
+	go func() {
+		var types []token.Type
+		for tok := range l.Reset("echo b\n") {
+			types = append(types, tok.Type)
+		}
+
+		done <- types
+	}()
+
+	select {
+	case types := <-done:
+		expected := []token.Type{token.String, token.String, token.Semicolon, token.Eof}
+		if !reflect.DeepEqual(types, expected) {
+			t.Errorf("expected tokens %v, got %v", expected, types)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Reset blocked on the undrained token channel")
+	}
+
+	if count != 0 {
+		t.Errorf("expected no errors from the abandoned source, got %d", count)
+	}
+}
+
+// lines is a workload of short lines, like the ones lexed by a repl.
+var lines = func() []string {
+	lines := make([]string, 10000)
+	for i := range lines {
+		lines[i] = "let x := x + 1"
+		if i%2 == 0 {
+			lines[i] = "echo hello world"
+		}
+	}
+
+	return lines
+}()
+
+func BenchmarkLex(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			for range lexer.Lex(line, nil) {
+			}
+		}
+	}
+}
+
+func BenchmarkReset(b *testing.B) {
+	b.ReportAllocs()
+	l := lexer.New(nil)
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			for range l.Reset(line) {
+			}
+		}
+	}
+}
+
+func TestLexerUnicode(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{"let café", token.Identifier, "café"},
+		{"let naïve_2", token.Identifier, "naïve_2"},
+		{"let 日本語", token.Identifier, "日本語"},
+		{"let αβγ", token.Identifier, "αβγ"},
+		{"let Ωmega+1", token.Identifier, "Ωmega"},
+		{"let x٣", token.Identifier, "x٣"},
+		{"let x。", token.Identifier, "x"},
+	}
+
+	for _, test := range tests {
+		var tokens []token.Token
+		for tok := range lexer.Lex(test.input, nil) {
+			tokens = append(tokens, tok)
+		}
+
+		if tokens[1].Type != test.expectedType {
+			t.Errorf("%q: expected token type %q, got %q", test.input, test.expectedType, tokens[1].Type)
+		}
+		if tokens[1].Literal != test.expectedLiteral {
+			t.Errorf("%q: expected token literal %q, got %q", test.input, test.expectedLiteral, tokens[1].Literal)
+		}
+	}
+
+	var words []string
+	for tok := range lexer.Lex("ünïcode wörd", nil) {
+		if tok.Type == token.String {
+			words = append(words, tok.Literal)
+		}
+	}
+
+	if len(words) != 2 || words[0] != "ünïcode" || words[1] != "wörd" {
+		t.Errorf("expected command words [ünïcode wörd], got %q", words)
+	}
+}
+
+func TestLexerKeywordPrefix(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"format disk", []token.Token{
+			{Type: token.String, Literal: "format", Position: token.Position{Line: 1, Col: 1}},
+			{Type: token.String, Literal: "disk", Position: token.Position{Line: 1, Col: 8}},
+		}},
+		{"iffy", []token.Token{
+			{Type: token.String, Literal: "iffy", Position: token.Position{Line: 1, Col: 1}},
+		}},
+		{"if-x y", []token.Token{
+			{Type: token.String, Literal: "if-x", Position: token.Position{Line: 1, Col: 1}},
+			{Type: token.String, Literal: "y", Position: token.Position{Line: 1, Col: 6}},
+		}},
+		{"letter\nlet x", []token.Token{
+			{Type: token.String, Literal: "letter", Position: token.Position{Line: 1, Col: 1}},
+			{Type: token.Semicolon, Literal: "\n", Position: token.Position{Line: 1, Col: 7}},
+			{Type: token.Let, Literal: "let", Position: token.Position{Line: 2, Col: 1}},
+			{Type: token.Identifier, Literal: "x", Position: token.Position{Line: 2, Col: 5}},
+		}},
+	}
+
+	for _, test := range tests {
+		var tokens []token.Token
+		for tok := range lexer.Lex(test.input, nil) {
+			tokens = append(tokens, tok)
+		}
+
+		if len(tokens) < len(test.expected) {
+			t.Fatalf("%q: expected at least %d tokens, got %d", test.input, len(test.expected), len(tokens))
+		}
+
+		for i, tok := range test.expected {
+			if tokens[i] != tok {
+				t.Errorf("%q: expected token %s, got %s", test.input, tok, tokens[i])
+			}
+		}
+	}
+}
+
+func TestLexerLeadingSpace(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedType token.Type
+		expectedCol  int
+	}{
+		{"  if x {\n}\n", token.If, 3},
+		{"\t for {\n}\n", token.For, 3},
+		{"\n\n   let x\n", token.Let, 4},
+		{"   echo hi\n", token.String, 4},
+	}
+
+	for _, test := range tests {
+		var tokens []token.Token
+		for tok := range lexer.Lex(test.input, nil) {
+			tokens = append(tokens, tok)
+		}
+
+		tok := tokens[0]
+		if tok.Type != test.expectedType {
+			t.Errorf("%q: expected token type %q, got %q", test.input, test.expectedType, tok.Type)
+		}
+		if tok.Position.Col != test.expectedCol {
+			t.Errorf("%q: expected token col %d, got %d", test.input, test.expectedCol, tok.Position.Col)
+		}
+	}
+}
+
+func TestLexerBrackets(t *testing.T) {
+	input := "let a[1] := [2]"
+	expected := []token.Type{
+		token.Let,
+		token.Identifier,
+		token.LeftBrack,
+		token.Number,
+		token.RightBrack,
+		token.Define,
+		token.LeftBrack,
+		token.Number,
+		token.RightBrack,
+		token.Semicolon,
+		token.Eof,
+	}
+
+	var types []token.Type
+	for tok := range lexer.Lex(input, nil) {
+		types = append(types, tok.Type)
+	}
+
+	if len(types) != len(expected) {
+		t.Fatalf("expected token types %v, got %v", expected, types)
+	}
+
+	for i, typ := range types {
+		if typ != expected[i] {
+			t.Errorf("case %v: expected token type %q, got %q", i, expected[i], typ)
+		}
+	}
+}
+
+func TestLexerBlockComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"let x /* comment */ / y", []token.Token{
+			{Type: token.Let, Literal: "let", Position: token.Position{Line: 1, Col: 1}},
+			{Type: token.Identifier, Literal: "x", Position: token.Position{Line: 1, Col: 5}},
+			{Type: token.Comment, Literal: "/* comment */", Position: token.Position{Line: 1, Col: 7}},
+			{Type: token.Quotient, Literal: "/", Position: token.Position{Line: 1, Col: 21}},
+			{Type: token.Identifier, Literal: "y", Position: token.Position{Line: 1, Col: 23}},
+		}},
+		{"/* a /* nested */ comment */ let x /= 2", []token.Token{
+			{Type: token.Comment, Literal: "/* a /* nested */ comment */", Position: token.Position{Line: 1, Col: 1}},
+			{Type: token.Let, Literal: "let", Position: token.Position{Line: 1, Col: 30}},
+			{Type: token.Identifier, Literal: "x", Position: token.Position{Line: 1, Col: 34}},
+			{Type: token.QuotientAssign, Literal: "/=", Position: token.Position{Line: 1, Col: 36}},
+		}},
+		{"/*\nmulti-line\n*/\necho /*", []token.Token{
+			{Type: token.Comment, Literal: "/*\nmulti-line\n*/", Position: token.Position{Line: 1, Col: 1}},
+			{Type: token.String, Literal: "echo", Position: token.Position{Line: 4, Col: 1}},
+			{Type: token.String, Literal: "/*", Position: token.Position{Line: 4, Col: 6}},
+		}},
+	}
+
+	for _, test := range tests {
+		var tokens []token.Token
+		for tok := range lexer.Lex(test.input, nil) {
+			tokens = append(tokens, tok)
+		}
+
+		if len(tokens) < len(test.expected) {
+			t.Fatalf("%q: expected at least %d tokens, got %d", test.input, len(test.expected), len(tokens))
+		}
+
+		for i, tok := range test.expected {
+			if tokens[i] != tok {
+				t.Errorf("%q: expected token %s, got %s", test.input, tok, tokens[i])
+			}
+		}
+	}
+}
+
+func TestLexerUnterminatedBlockComment(t *testing.T) {
+	input := "let x\nlet y /* a /* b */\n"
+
+	var errs []token.Position
+	handler := func(pos token.Position, err error) {
+		if err != lexer.ErrComment {
+			t.Errorf("expected error %v, got %v", lexer.ErrComment, err)
+		}
+
+		errs = append(errs, pos)
+	}
+
+	for range lexer.Lex(input, handler) {
+	}
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(errs))
+	}
+
+	if errs[0].Line != 2 || errs[0].Col != 7 {
+		t.Errorf("expected error at 2:7, got %s", &errs[0])
+	}
+}
+
+func TestLexerSubshell(t *testing.T) {
+	input := "(cd /tmp; let x := f(1)) && echo b;c"
+	expected := []token.Token{
+		{Type: token.LeftParen, Literal: "(", Position: token.Position{Line: 1, Col: 1}},
+		{Type: token.String, Literal: "cd", Position: token.Position{Line: 1, Col: 2}},
+		{Type: token.String, Literal: "/tmp", Position: token.Position{Line: 1, Col: 5}},
+		{Type: token.Semicolon, Literal: ";", Position: token.Position{Line: 1, Col: 9}},
+		{Type: token.Let, Literal: "let", Position: token.Position{Line: 1, Col: 11}},
+		{Type: token.Identifier, Literal: "x", Position: token.Position{Line: 1, Col: 15}},
+		{Type: token.Define, Literal: ":=", Position: token.Position{Line: 1, Col: 17}},
+		{Type: token.Identifier, Literal: "f", Position: token.Position{Line: 1, Col: 20}},
+		{Type: token.LeftParen, Literal: "(", Position: token.Position{Line: 1, Col: 21}},
+		{Type: token.Number, Literal: "1", Position: token.Position{Line: 1, Col: 22}},
+		{Type: token.RightParen, Literal: ")", Position: token.Position{Line: 1, Col: 23}},
+		{Type: token.Semicolon, Literal: "", Position: token.Position{Line: 1, Col: 24}},
+		{Type: token.RightParen, Literal: ")", Position: token.Position{Line: 1, Col: 24}},
+		{Type: token.LogicalAnd, Literal: "&&", Position: token.Position{Line: 1, Col: 26}},
+		{Type: token.String, Literal: "echo", Position: token.Position{Line: 1, Col: 29}},
+		{Type: token.String, Literal: "b", Position: token.Position{Line: 1, Col: 34}},
+		{Type: token.Semicolon, Literal: ";", Position: token.Position{Line: 1, Col: 35}},
+		{Type: token.String, Literal: "c", Position: token.Position{Line: 1, Col: 36}},
+		{Type: token.Semicolon, Literal: "", Position: token.Position{Line: 1, Col: 37}},
+		{Type: token.Eof, Literal: "", Position: token.Position{Line: 1, Col: 37}},
+	}
+
+	var tokens []token.Token
+	for tok := range lexer.Lex(input, nil) {
+		tokens = append(tokens, tok)
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d:\n%s", len(expected), len(tokens), token.Dump(tokens))
+	}
+
+	for i, tok := range tokens {
+		if tok != expected[i] {
+			t.Errorf("case %v: expected token %s, got %s", i, expected[i], tok)
+		}
+	}
+}
+
+func TestLexerSemicolonInsertion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Type
+	}{
+		{"echo a\necho b\n", []token.Type{
+			token.String, token.String, token.Semicolon,
+			token.String, token.String, token.Semicolon,
+			token.Eof,
+		}},
+		{"let x := 1\nlet y := x\n", []token.Type{
+			token.Let, token.Identifier, token.Define, token.Number, token.Semicolon,
+			token.Let, token.Identifier, token.Define, token.Identifier, token.Semicolon,
+			token.Eof,
+		}},
+		{"let x := f(a,\nb\n)\n", []token.Type{
+			token.Let, token.Identifier, token.Define, token.Identifier, token.LeftParen,
+			token.Identifier, token.Comma, token.Identifier, token.RightParen, token.Semicolon,
+			token.Eof,
+		}},
+		{"echo a |\ngrep b\n", []token.Type{
+			token.String, token.String, token.Or,
+			token.String, token.String, token.Semicolon,
+			token.Eof,
+		}},
+		{"a &&\n\n# comment\nb &\nc\n", []token.Type{
+			token.String, token.LogicalAnd, token.Comment,
+			token.String, token.And, token.Semicolon,
+			token.String, token.Semicolon,
+			token.Eof,
+		}},
+		{"let x := [1\n, (2\n)]\n", []token.Type{
+			token.Let, token.Identifier, token.Define, token.LeftBrack, token.Number, token.Comma,
+			token.LeftParen, token.Number, token.RightParen, token.RightBrack, token.Semicolon,
+			token.Eof,
+		}},
+	}
+
+	for _, test := range tests {
+		var types []token.Type
+		for tok := range lexer.Lex(test.input, nil) {
+			types = append(types, tok.Type)
+		}
+
+		if len(types) != len(test.expected) {
+			t.Fatalf("%q: expected tokens %v, got %v", test.input, test.expected, types)
+		}
+
+		for i, typ := range types {
+			if typ != test.expected[i] {
+				t.Errorf("%q: token %d: expected %s, got %s", test.input, i, test.expected[i], typ)
+			}
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected lexer.LexState
+	}{
+		{"echo a\n", lexer.LexState{}},
+		{"let x := \"abc\n", lexer.LexState{String: true}},
+		{"echo `abc\n", lexer.LexState{String: true}},
+		{"echo a\"b c\n", lexer.LexState{String: true}},
+		{"let x := 'a {b}", lexer.LexState{String: true}},
+		{"let x := 1 /* a /* b */\n", lexer.LexState{Comment: true}},
+		{"if x {\necho a\n", lexer.LexState{Depth: 1}},
+		{"let x := f([1,\n", lexer.LexState{Depth: 2, Continued: true}},
+		{"(echo a; (echo b\n", lexer.LexState{Depth: 2}},
+		{"let f := func {\nlet x := 'a {b", lexer.LexState{String: true, Depth: 2}},
+		{"echo a)\n", lexer.LexState{}},
+		{"echo a |", lexer.LexState{Continued: true}},
+		{"echo a ||\n", lexer.LexState{Continued: true}},
+		{"echo a &&\n# comment\n", lexer.LexState{Continued: true}},
+		{"echo a |\ngrep b\n", lexer.LexState{}},
+		{"echo a | grep b\n", lexer.LexState{}},
+		{"echo a &\n", lexer.LexState{}},
+		{"let x := 1 +", lexer.LexState{Continued: true}},
+		{"let x := 1 *\n# comment\n", lexer.LexState{Continued: true}},
+		{"let x := 1 +\n2\n", lexer.LexState{}},
+		{"let x := f(1,\n", lexer.LexState{Depth: 1, Continued: true}},
+		{"let x := f(1,\n2)\n", lexer.LexState{}},
+		{"let x :=", lexer.LexState{Continued: true}},
+	}
+
+	for _, test := range tests {
+		state := lexer.State(test.input)
+		if state != test.expected {
+			t.Errorf("%q: expected state %+v, got %+v", test.input, test.expected, state)
+		}
+
+		complete := test.expected == (lexer.LexState{})
+		if state.Complete() != complete {
+			t.Errorf("%q: expected complete to be %v", test.input, complete)
+		}
+	}
+}
+
+func TestLexerCRLF(t *testing.T) {
+	input := `# comment
+let x := f(1,
+2) /* block
+comment */
+let s := ` + "`raw\nstring`" + `
+echo a |
+grep "b c"  # trailing
+if x {
+	echo 'template
+{x}'
+}
+`
+
+	var expected []token.Token
+	for tok := range lexer.Lex(input, nil) {
+		expected = append(expected, tok)
+	}
+
+	var tokens []token.Token
+	for tok := range lexer.Lex(strings.ReplaceAll(input, "\n", "\r\n"), nil) {
+		tokens = append(tokens, tok)
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d:\n%s", len(expected), len(tokens), token.Dump(tokens))
+	}
+
+	// comments and quoted strings keep their line endings, while inserted
+	// semicolons have the literal "\n" with either line ending
+	literals := map[string]string{
+		"/* block\ncomment */": "/* block\r\ncomment */",
+		"`raw\nstring`":        "`raw\r\nstring`",
+		"template\n":           "template\r\n",
+	}
+
+	differences := 0
+	for i, tok := range tokens {
+		want := expected[i]
+		if lit, ok := literals[want.Literal]; ok {
+			want.Literal = lit
+			differences++
+		}
+
+		if tok != want {
+			t.Errorf("case %v: expected token %s, got %s", i, want, tok)
+		}
+	}
+
+	if differences != len(literals) {
+		t.Errorf("expected %d tokens with different literals, got %d", len(literals), differences)
+	}
+}
+
+func TestLexerCommandOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"a & b", []token.Token{
+			{Type: token.String, Literal: "a", Position: token.Position{Line: 1, Col: 1}},
+			{Type: token.And, Literal: "&", Position: token.Position{Line: 1, Col: 3}},
+			{Type: token.String, Literal: "b", Position: token.Position{Line: 1, Col: 5}},
+		}},
+		{"a && b", []token.Token{
+			{Type: token.String, Literal: "a", Position: token.Position{Line: 1, Col: 1}},
+			{Type: token.LogicalAnd, Literal: "&&", Position: token.Position{Line: 1, Col: 3}},
+			{Type: token.String, Literal: "b", Position: token.Position{Line: 1, Col: 6}},
+		}},
+		{"a | b", []token.Token{
+			{Type: token.String, Literal: "a", Position: token.Position{Line: 1, Col: 1}},
+			{Type: token.Or, Literal: "|", Position: token.Position{Line: 1, Col: 3}},
+			{Type: token.String, Literal: "b", Position: token.Position{Line: 1, Col: 5}},
+		}},
+		{"a || b", []token.Token{
+			{Type: token.String, Literal: "a", Position: token.Position{Line: 1, Col: 1}},
+			{Type: token.LogicalOr, Literal: "||", Position: token.Position{Line: 1, Col: 3}},
+			{Type: token.String, Literal: "b", Position: token.Position{Line: 1, Col: 6}},
+		}},
+		{"a&&b|c", []token.Token{
+			{Type: token.String, Literal: "a", Position: token.Position{Line: 1, Col: 1}},
+			{Type: token.LogicalAnd, Literal: "&&", Position: token.Position{Line: 1, Col: 2}},
+			{Type: token.String, Literal: "b", Position: token.Position{Line: 1, Col: 4}},
+			{Type: token.Or, Literal: "|", Position: token.Position{Line: 1, Col: 5}},
+			{Type: token.String, Literal: "c", Position: token.Position{Line: 1, Col: 6}},
+		}},
+		{"a|||&&&b", []token.Token{
+			{Type: token.String, Literal: "a", Position: token.Position{Line: 1, Col: 1}},
+			{Type: token.LogicalOr, Literal: "||", Position: token.Position{Line: 1, Col: 2}},
+			{Type: token.Or, Literal: "|", Position: token.Position{Line: 1, Col: 4}},
+			{Type: token.LogicalAnd, Literal: "&&", Position: token.Position{Line: 1, Col: 5}},
+			{Type: token.And, Literal: "&", Position: token.Position{Line: 1, Col: 7}},
+			{Type: token.String, Literal: "b", Position: token.Position{Line: 1, Col: 8}},
+		}},
+	}
+
+	for _, test := range tests {
+		var tokens []token.Token
+		for tok := range lexer.Lex(test.input, nil) {
+			if tok.Type == token.Semicolon || tok.Type == token.Eof {
+				continue
+			}
+
+			tokens = append(tokens, tok)
+		}
+
+		if len(tokens) != len(test.expected) {
+			t.Fatalf("%q: expected %d tokens, got %d:\n%s", test.input, len(test.expected), len(tokens), token.Dump(tokens))
+		}
+
+		for i, tok := range tokens {
+			if tok != test.expected[i] {
+				t.Errorf("%q: case %v: expected token %s, got %s", test.input, i, test.expected[i], tok)
+			}
+		}
+	}
+}
+
+func TestLexerBinary(t *testing.T) {
+	tests := []struct {
+		input  string
+		binary bool
+	}{
+		{"echo a\x00b\nlet x := \x00\x00\x01\n", true},
+		{"\x7fELF\x02\x01\x01\x03\x04\x05\x06echo", true},
+		{"echo \x1b[32mgreen\x1b[0m\n", false},
+		{"echo caf\xe9\n", false},
+		{"caf\xe9\xe9\xe9", true},
+		{strings.Repeat("echo a\n", 200) + "echo \x00\n", false},
+	}
+
+	for _, test := range tests {
+		var errs []error
+		handler := func(_ token.Position, err error) {
+			errs = append(errs, err)
+		}
+
+		var tokens []token.Token
+		for tok := range lexer.Lex(test.input, handler) {
+			tokens = append(tokens, tok)
+		}
+
+		binary := len(errs) > 0 && errs[0] == lexer.ErrBinary
+		if binary != test.binary {
+			t.Errorf("%q: expected binary to be %v, got errors %v", test.input, test.binary, errs)
+			continue
+		}
+
+		if !binary {
+			continue
+		}
+
+		if len(errs) != 1 {
+			t.Errorf("%q: expected a single error, got %v", test.input, errs)
+		}
+
+		if len(tokens) != 1 || tokens[0].Type != token.Eof {
+			t.Errorf("%q: expected only an EOF token, got:\n%s", test.input, token.Dump(tokens))
+		}
+	}
+}
+
+func TestLexerNormalize(t *testing.T) {
+	const (
+		composed   = "caf\u00e9"  // é as a single rune
+		decomposed = "cafe\u0301" // e followed by a combining acute accent
+	)
+
+	// literals returns the literals of the identifier and string tokens
+	// lexed from src by l.
+	literals := func(l *lexer.Lexer, src string) []string {
+		var lits []string
+		for tok := range l.Reset(src) {
+			switch tok.Type {
+			case token.Identifier, token.String:
+				lits = append(lits, tok.Literal)
+			}
+		}
+
+		return lits
+	}
+
+	// identifier, command word, quoted string, and quoted word piece
+	src := func(word string) string {
+		return "let " + word + " := 1\necho " + word + "\nlet x := \"" + word + "\"\necho " + word + "\"" + word + "\"\n"
+	}
+
+	l := lexer.New(func(pos token.Position, err error) {
+		t.Errorf("%s: %v", &pos, err)
+	})
+
+	nfc := literals(l, src(composed))
+	if expected := []string{composed, "echo", composed, "x", `"` + composed + `"`, "echo", composed + `"` + composed + `"`}; !reflect.DeepEqual(nfc, expected) {
+		t.Fatalf("expected literals %q, got %q", expected, nfc)
+	}
+
+	// without normalization the forms are distinct
+	if nfd := literals(l, src(decomposed)); nfd[0] != decomposed || nfd[2] != decomposed {
+		t.Errorf("expected decomposed literals, got %q", nfd)
+	}
+
+	l.Normalize = true
+
+	// quoted strings and quoted word pieces are not normalized
+	nfd := literals(l, src(decomposed))
+	if expected := []string{composed, "echo", composed, "x", `"` + decomposed + `"`, "echo", composed + `"` + decomposed + `"`}; !reflect.DeepEqual(nfd, expected) {
+		t.Errorf("expected literals %q, got %q", expected, nfd)
+	}
+
+	// Normalize is kept across Resets
+	if again := literals(l, src(decomposed)); !reflect.DeepEqual(again, nfd) {
+		t.Errorf("expected literals %q after reset, got %q", nfd, again)
+	}
+}
+
+func TestLexerEOF(t *testing.T) {
+	tests := []string{
+		"let x := 1",
+		"let x := 1\n",
+		"echo a",
+		"echo a | grep b\n",
+		"(echo a",
+		"if x {\necho a",
+		"echo \"unterminated",
+		"let x := $ + 1\n",
+	}
+
+	for _, strict := range []bool{false, true} {
+		l := lexer.New(nil)
+		l.Strict = strict
+
+		for _, input := range tests {
+			var tokens []token.Token
+			for tok := range l.Reset(input) {
+				tokens = append(tokens, tok)
+			}
+
+			eofs := 0
+			for _, tok := range tokens {
+				if tok.Type == token.Eof {
+					eofs++
+				}
+			}
+
+			if eofs != 1 || tokens[len(tokens)-1].Type != token.Eof {
+				t.Errorf("%q: expected a single trailing EOF token, got:\n%s", input, token.Dump(tokens))
+			}
+		}
+	}
+}
+
+func TestLexerStrict(t *testing.T) {
+	input := "let x := 1 $ 2\necho \"a\nlet y := 3\n"
+
+	l := lexer.New(nil)
+
+	var tokens []token.Token
+	for tok := range l.Reset(input) {
+		tokens = append(tokens, tok)
+	}
+
+	if last := tokens[len(tokens)-1]; last.Type != token.Eof || last.Position.Line != 4 {
+		t.Errorf("expected lexing to continue till the end, got:\n%s", token.Dump(tokens))
+	}
+
+	l.Strict = true
+	tokens = nil
+	for tok := range l.Reset(input) {
+		tokens = append(tokens, tok)
+	}
+
+	expected := []token.Token{
+		{Type: token.Let, Literal: "let", Position: token.Position{Line: 1, Col: 1}},
+		{Type: token.Identifier, Literal: "x", Position: token.Position{Line: 1, Col: 5}},
+		{Type: token.Define, Literal: ":=", Position: token.Position{Line: 1, Col: 7}},
+		{Type: token.Number, Literal: "1", Position: token.Position{Line: 1, Col: 10}},
+		{Type: token.Illegal, Literal: "$", Position: token.Position{Line: 1, Col: 12}},
+		{Type: token.Eof, Literal: "", Position: token.Position{Line: 1, Col: 13}},
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d:\n%s", len(expected), len(tokens), token.Dump(tokens))
+	}
+
+	for i, tok := range tokens {
+		if tok != expected[i] {
+			t.Errorf("case %v: expected token %s, got %s", i, expected[i], tok)
+		}
+	}
+}
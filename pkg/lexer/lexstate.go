@@ -0,0 +1,68 @@
+// Copyright © 2022 Rak Laptudirm <raklaptudirm@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lexer
+
+import (
+	"errors"
+
+	"laptudirm.com/x/mash/pkg/token"
+)
+
+// LexState represents the state of the lexer at the end of a source. It
+// is used to check if a source is incomplete, like when a REPL has to
+// decide whether to prompt for more input.
+type LexState struct {
+	String    bool // inside an unterminated string
+	Comment   bool // inside an unterminated block comment
+	Depth     int  // number of unclosed parenthesis, brackets, and braces
+	Continued bool // ends with an operator which continues it's statement
+}
+
+// Complete reports whether the source ended outside of any string, block
+// comment, or bracket group, and without an operator continuing it on the
+// next line, like a '|' in a command or a '+' in a statement.
+func (s LexState) Complete() bool {
+	return !s.String && !s.Comment && s.Depth == 0 && !s.Continued
+}
+
+// State lexes src and returns the lexer's state at the end of it. Closing
+// brackets without a matching opening bracket are ignored.
+func State(src string) LexState {
+	var state LexState
+
+	handler := func(_ token.Position, err error) {
+		switch {
+		case errors.Is(err, ErrString):
+			state.String = true
+		case errors.Is(err, ErrComment):
+			state.Comment = true
+		}
+	}
+
+	l := New(handler)
+	for tok := range l.Reset(src) {
+		switch tok.Type {
+		case token.LeftParen, token.LeftBrack, token.LeftBrace:
+			state.Depth++
+		case token.RightParen, token.RightBrack, token.RightBrace:
+			if state.Depth > 0 {
+				state.Depth--
+			}
+		}
+	}
+
+	// the lexer is done once it's token channel is closed
+	state.Continued = l.continued
+	return state
+}
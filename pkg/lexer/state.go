@@ -16,21 +16,83 @@ package lexer
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"laptudirm.com/x/mash/pkg/token"
 )
 
-var ErrEOF = errors.New("unexpected EOF")
+var (
+	ErrEOF     = errors.New("unexpected EOF")
+	ErrString  = errors.New("unterminated string literal")
+	ErrComment = errors.New("unterminated block comment")
+	ErrChar    = errors.New("unexpected character")
+	ErrJoin    = errors.New("template literal joined to an adjacent word")
+	ErrCommand = errors.New("source is a command, not an expression")
+)
+
+// run starts lexing the source in l with the state function lex and closes
+// the lexer's token channel when it is done. Binary sources are not lexed,
+// and only an EOF token is emitted for them. The token stream always ends
+// with a single EOF token, even if lexing is stopped early by strict mode,
+// unless the lexer is stopped by Reset.
+func (l *Lexer) run(lex func()) {
+	defer func() {
+		if e := recover(); e != nil {
+			if _, ok := e.(bailout); !ok {
+				panic(e) // not a strict mode or Reset stop
+			}
+		}
+
+		close(l.Tokens)
+	}()
+
+	if isBinary(l.src) {
+		// fail fast instead of reporting every illegal rune
+		l.error(ErrBinary)
+		l.emit(token.Eof)
+	} else {
+		lex()
+	}
+}
 
-// run starts lexing the source in l and closes the lexer's token channel
-// when it is done.
-func (l *lexer) run() {
+// lexProgram lexes the whole source as a program.
+func (l *Lexer) lexProgram() {
 	l.lexBlock(eof, token.Eof)
-	close(l.Tokens)
 }
 
-func (l *lexer) lexBlock(eob rune, tok token.Type) {
+// lexExpr lexes the whole source in statement mode, inserting semicolons
+// where the statements end. Sources which look like a command are reported
+// and lexed as a single illegal token.
+func (l *Lexer) lexExpr() {
+	if isCommand(l.src) {
+		l.errorAt(l.start, ErrCommand)
+		l.emitLiteral(token.Illegal, l.src)
+		l.emit(token.Eof)
+		return
+	}
+
+	for {
+		l.consumeAllSpace()
+
+		if l.peek() == eof {
+			l.consume()
+			l.emit(token.Eof)
+			return
+		}
+
+		l.insertSemi = false
+		l.lexStmt(eof)
+
+		// the statement isn't over if it's group wasn't closed
+		if !l.unclosed {
+			l.emitSemicolon()
+		}
+	}
+}
+
+func (l *Lexer) lexBlock(eob rune, tok token.Type) {
 	for {
 		r := l.peek()
 		switch {
@@ -39,6 +101,11 @@ func (l *lexer) lexBlock(eob rune, tok token.Type) {
 			l.emit(tok)
 			return // block lexed
 
+		case r == eof:
+			// block wasn't terminated, reported by the parser
+			l.unclosed = true
+			return
+
 		// ignore all space runes
 		case unicode.IsSpace(r):
 			l.consumeAllSpace()
@@ -46,55 +113,85 @@ func (l *lexer) lexBlock(eob rune, tok token.Type) {
 		case r == '#':
 			l.lexComment()
 
+		case l.follows("/*"):
+			l.consume() // starting '/'
+			l.lexBlockComment()
+
 		// command or statement
 		default:
-			if isAlphabet(r) {
-				l.consumeWord()
+			if isIdentStart(r) {
+				l.consumeIdent()
 
 				word := l.literal()
 				// statement starts with keyword
-				if token.IsKeyword(word) {
+				if token.IsKeyword(word) && isKeywordEnd(l.peek()) {
 					t := token.Lookup(word)
 					l.emit(t)
 					l.insertSemi = t.InsertSemi()
 
+					// case clause headers end at their colon
+					l.clause = t == token.Case || t == token.Default
+
 					l.lexStmt(eob)
 
 					// semicolon insertion
-					l.emit(token.Semicolon)
+					if !l.clause && !l.unclosed {
+						l.emitSemicolon()
+					}
+
+					l.clause = false
 					break
 				}
 
 				// commands don't start with a keyword
-				// TODO: cleanup
-				l.rdOffset = l.offset
-				l.pos = l.start
+				l.rewind()
 			}
 
 			l.lexCmd(eob)
 
 			// semicolon insertion
-			l.emit(token.Semicolon)
+			if !l.unclosed {
+				l.emitSemicolon()
+			}
 		}
 	}
 }
 
-func isAlphabet(r rune) bool {
-	return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z'
+// isKeywordEnd checks if r can follow a keyword which starts a statement.
+// Words which continue past the keyword, like if-else, are commands.
+func isKeywordEnd(r rune) bool {
+	switch r {
+	case eof, ':', ';', '{', '(':
+		return true
+	default:
+		return unicode.IsSpace(r)
+	}
 }
 
-func (l *lexer) lexStmt(eos rune) {
+func (l *Lexer) lexStmt(eos rune) {
+	depth := 0 // number of unclosed parenthesis and brackets
+
 	for {
 		l.consume()
 
 		switch {
-		case l.ch == eos:
+		// a ')' inside the statement's own parenthesis doesn't end a subshell
+		case l.ch == eos && (eos != ')' || depth == 0), l.ch == eof:
+			if l.ch == eof {
+				// source ended inside parenthesis or brackets
+				l.unclosed = l.unclosed || depth > 0
+				// or after an operator which continues the statement
+				l.continued = !l.insertSemi
+			}
+
 			l.backup()
 			return // will be handled by caller
 
 		case l.ch == '\n':
-			if l.insertSemi {
-				// if semicolon is inserted the statement ends
+			if l.insertSemi && depth == 0 {
+				// if semicolon is inserted the statement ends, and
+				// so does a case clause header missing it's colon
+				l.clause = false
 				return
 			}
 
@@ -132,30 +229,48 @@ func (l *lexer) lexStmt(eos rune) {
 			// semicolon should be inserted after a string
 			l.insertSemi = true
 
+		case l.ch == '/' && l.peek() == '*':
+			l.lexBlockComment()
+
 		// all operator starting runes are themselves operators
 		case token.IsOperator(string(l.ch)):
 			t := l.lexStmtOp()
 			l.insertSemi = t.InsertSemi()
 
+			// semicolons are not inserted inside parenthesis and brackets
+			switch t {
+			case token.LeftParen, token.LeftBrack:
+				depth++
+			case token.RightParen, token.RightBrack:
+				if depth > 0 {
+					depth--
+				}
+			}
+
+			if t == token.Colon && l.clause && depth == 0 {
+				// case clause header has ended, colons inside
+				// object literals don't end it
+				return
+			}
+
 		case l.ch == '#':
 			// line comment
 			l.lexComment()
 
 		default:
 			// rune not supported inside statements
+			l.errorAt(l.start, ErrChar)
 			l.emit(token.Illegal)
 		}
 	}
 }
 
-func (l *lexer) lexIdent() token.Type {
-	for isIdent(l.peek()) {
-		l.consume()
-	}
+func (l *Lexer) lexIdent() token.Type {
+	l.consumeIdent()
 
 	// lookup the token type of literal
 	t := token.Lookup(l.literal())
-	l.emit(t)
+	l.emitWord(t)
 	return t
 }
 
@@ -163,7 +278,7 @@ func isIdentStart(r rune) bool {
 	return r == '_' || unicode.IsLetter(r)
 }
 
-func (l *lexer) lexNum() {
+func (l *Lexer) lexNum() {
 	base := 10 // number base
 
 	// 0b, 0o, or 0x base specs
@@ -228,7 +343,7 @@ func isExponent(r rune, base int) bool {
 	}
 }
 
-func (l *lexer) lexDigits(base int, required bool) {
+func (l *Lexer) lexDigits(base int, required bool) {
 	if !isBaseDigit(l.peek(), base) {
 		if required {
 			l.error(fmt.Errorf("invalid number literal"))
@@ -267,7 +382,7 @@ func isBaseDigit(r rune, b int) bool {
 	}
 }
 
-func (l *lexer) makeOp(target rune, pass token.Type, fail token.Type) token.Type {
+func (l *Lexer) makeOp(target rune, pass token.Type, fail token.Type) token.Type {
 	if l.peek() == target {
 		l.consume()
 		return pass
@@ -276,7 +391,7 @@ func (l *lexer) makeOp(target rune, pass token.Type, fail token.Type) token.Type
 	return fail
 }
 
-func (l *lexer) lexStmtOp() token.Type {
+func (l *Lexer) lexStmtOp() token.Type {
 	var t token.Type
 	switch l.ch {
 	case '+':
@@ -356,38 +471,100 @@ func (l *lexer) lexStmtOp() token.Type {
 	return t
 }
 
-func (l *lexer) lexCmd(eoc rune) {
+func (l *Lexer) lexCmd(eoc rune) {
+	// commands ending with a '|', '||', or '&&' continue on the next line,
+	// while '&' is left for the parser to report since it isn't supported
+	cont := false
+
 	for {
 		l.consume()
 
 		switch {
-		case l.ch == eoc:
+		case l.ch == eoc, l.ch == eof:
+			l.continued = l.ch == eof && cont
+
 			l.backup()
 			return // will be handled by lexBlock
 
-		case l.ch == '\n':
+		case l.ch == '\n' && cont:
+			// ignore all space
+			l.consumeAllSpace()
+
+		case l.ch == '\n', l.ch == ';':
 			return // insertion in handled by lexBlock
 
 		case unicode.IsSpace(l.ch):
 			// ignore all space
 			l.consumeSpace()
 
-		case l.ch == '"' || l.ch == '\'' || l.ch == '`':
-			l.lexString()
-
 		case l.ch == '#':
 			l.lexComment()
 
 		case isCmdOp(l.ch):
-			l.lexCmdOp()
+			t := l.lexCmdOp()
+			cont = t == token.Or || t == token.LogicalOr || t == token.LogicalAnd
 
 		default:
-			l.consumeWord()
-			l.emit(token.String)
+			cont = false
+
+			switch l.ch {
+			case '(':
+				// subshell
+				l.emit(token.LeftParen)
+
+				l.subshells++
+				l.lexBlock(')', token.RightParen)
+				l.subshells--
+
+			case '\'':
+				l.lexEmbeddedString()
+				l.checkJoin()
+
+			default:
+				l.backup()
+				l.lexWord()
+				l.checkJoin()
+			}
 		}
 	}
 }
 
+// checkJoin reports an error if the word or template literal which was
+// just lexed is followed by a template literal or a word with no space
+// between them, since template literals can't be joined to words. An
+// illegal token is emitted at the join so that the command isn't parsed.
+func (l *Lexer) checkJoin() {
+	if r := l.peek(); r == '\'' || !l.isWordEnd(r, 0) {
+		l.errorAt(l.start, ErrJoin)
+		l.emit(token.Illegal)
+	}
+}
+
+// isCommand reports whether src looks like a command instead of an
+// expression, which is the case if it starts with a name followed by space
+// and then a word, like cat file, which is never a valid expression. Names
+// followed by flags, like ls -la, are valid subtractions, and names on their
+// own may be variables, so those are left for the caller to decide.
+func isCommand(src string) bool {
+	src = strings.TrimLeftFunc(src, unicode.IsSpace)
+
+	name := strings.IndexFunc(src, func(r rune) bool {
+		return !isIdent(r)
+	})
+
+	if name < 1 || token.IsKeyword(src[:name]) {
+		return false // no name, or a statement
+	}
+
+	args := strings.TrimLeft(src[name:], " \t")
+	if len(args) == len(src[name:]) {
+		return false // no space after the name
+	}
+
+	r, _ := utf8.DecodeRuneInString(args)
+	return isIdentStart(r)
+}
+
 func isCmdOp(r rune) bool {
 	switch r {
 	case '|', '&', '!':
@@ -397,7 +574,7 @@ func isCmdOp(r rune) bool {
 	}
 }
 
-func (l *lexer) lexCmdOp() token.Type {
+func (l *Lexer) lexCmdOp() token.Type {
 	var t token.Type
 	switch l.ch {
 	case '|':
@@ -415,7 +592,7 @@ func (l *lexer) lexCmdOp() token.Type {
 	return t
 }
 
-func (l *lexer) lexComment() {
+func (l *Lexer) lexComment() {
 	// consume tokens till newline or eof
 	for r := l.peek(); r != '\n' && r != eof; r = l.peek() {
 		l.consume()
@@ -424,7 +601,35 @@ func (l *lexer) lexComment() {
 	l.emit(token.Comment)
 }
 
-func (l *lexer) lexString() {
+// lexBlockComment lexes a block comment whose starting '/' has already
+// been consumed. Block comments can be nested, and an unterminated block
+// comment is reported at it's start.
+func (l *Lexer) lexBlockComment() {
+	l.consume() // starting '*'
+
+	for depth := 1; depth > 0; {
+		switch {
+		case l.peek() == eof:
+			l.errorAt(l.start, ErrComment)
+			l.emit(token.Illegal)
+			return
+		case l.follows("/*"):
+			l.consume()
+			l.consume()
+			depth++
+		case l.follows("*/"):
+			l.consume()
+			l.consume()
+			depth--
+		default:
+			l.consume()
+		}
+	}
+
+	l.emit(token.Comment)
+}
+
+func (l *Lexer) lexString() {
 	switch l.ch {
 	case '`':
 		l.lexRawString()
@@ -435,23 +640,45 @@ func (l *lexer) lexString() {
 	}
 }
 
-func (l *lexer) lexRawString() {
+func (l *Lexer) lexRawString() {
+	if !l.consumeRawString() {
+		l.emit(token.Illegal)
+		return
+	}
+
+	l.emit(token.String)
+}
+
+// consumeRawString consumes a raw string whose starting '`' has already
+// been consumed. It returns false if the string is not terminated.
+func (l *Lexer) consumeRawString() bool {
 	// consume tokens till '`' or eof
 	for r := l.peek(); r != '`' && r != eof; r = l.peek() {
 		l.consume()
 	}
 
 	if l.peek() == eof {
-		l.error(ErrEOF)
+		l.error(ErrString)
+		return false
+	}
+
+	l.consume() // consume the trailing '`'
+	return true
+}
+
+func (l *Lexer) lexInterpretedString() {
+	if !l.consumeInterpretedString() {
 		l.emit(token.Illegal)
 		return
 	}
 
-	l.consume() // consume the trailing '`'
 	l.emit(token.String)
 }
 
-func (l *lexer) lexInterpretedString() {
+// consumeInterpretedString consumes an interpreted string whose starting
+// '"' has already been consumed. It returns false if the string is not
+// terminated.
+func (l *Lexer) consumeInterpretedString() bool {
 	// consume tokens till '"' or eof
 	for r := l.peek(); r != '"' && r != eof; r = l.peek() {
 		l.consume()
@@ -463,22 +690,21 @@ func (l *lexer) lexInterpretedString() {
 	}
 
 	if l.peek() == eof {
-		l.error(ErrEOF)
-		l.emit(token.Illegal)
-		return
+		l.error(ErrString)
+		return false
 	}
 
 	l.consume() // consume the trailing '"'
-	l.emit(token.String)
+	return true
 }
 
-func (l *lexer) lexEmbeddedString() {
+func (l *Lexer) lexEmbeddedString() {
 	l.emit(token.Template) // starting "'"
 
 	for {
 		switch r := l.peek(); r {
 		case eof:
-			l.error(ErrEOF)
+			l.error(ErrString)
 			l.emit(token.Illegal)
 			return
 
@@ -502,6 +728,11 @@ func (l *lexer) lexEmbeddedString() {
 			l.emit(token.LeftBrace)
 
 			l.lexEmbeddedExpr()
+			if l.ch == eof {
+				// reported at the start of the next iteration
+				break
+			}
+
 			l.emit(token.RightBrace) // ending "}"
 
 		default:
@@ -515,7 +746,7 @@ func (l *lexer) lexEmbeddedString() {
 	}
 }
 
-func (l *lexer) lexEmbeddedExpr() {
+func (l *Lexer) lexEmbeddedExpr() {
 	for {
 		l.consume()
 
@@ -524,6 +755,10 @@ func (l *lexer) lexEmbeddedExpr() {
 		case l.ch == '}':
 			return
 
+		// will be handled by lexEmbeddedString
+		case l.ch == eof:
+			return
+
 		case unicode.IsSpace(l.ch):
 			l.consumeAllSpace()
 
@@ -542,6 +777,7 @@ func (l *lexer) lexEmbeddedExpr() {
 
 		default:
 			// rune not supported inside embedded expressions
+			l.errorAt(l.start, ErrChar)
 			l.emit(token.Illegal)
 		}
 	}
@@ -552,7 +788,7 @@ var (
 	ErrEscEnd = errors.New("unterminated escape sequence")
 )
 
-func (l *lexer) lexStringEscape(t rune) {
+func (l *Lexer) lexStringEscape(t rune) {
 	var radix, n int
 	switch l.peek() {
 	case 'a', 'b', 'f', 'n', 'r', 't', 'v', '\\', t:
@@ -581,7 +817,6 @@ func (l *lexer) lexStringEscape(t rune) {
 	for i := 0; i < n; i++ {
 		r := l.peek()
 		if r == eof || r == t {
-			fmt.Println(r)
 			l.error(ErrEscEnd)
 			return
 		}
@@ -596,7 +831,7 @@ func (l *lexer) lexStringEscape(t rune) {
 }
 
 // consumeSpace consumes all non newline space runes.
-func (l *lexer) consumeSpace() {
+func (l *Lexer) consumeSpace() {
 	for r := l.peek(); unicode.IsSpace(r) && r != '\n'; r = l.peek() {
 		l.consume()
 	}
@@ -605,7 +840,7 @@ func (l *lexer) consumeSpace() {
 }
 
 // consumeAllSpace consumes all space runes.
-func (l *lexer) consumeAllSpace() {
+func (l *Lexer) consumeAllSpace() {
 	for unicode.IsSpace(l.peek()) {
 		l.consume()
 	}
@@ -613,12 +848,91 @@ func (l *lexer) consumeAllSpace() {
 	l.ignore()
 }
 
+// isIdent checks if r can be a part of an identifier. Combining marks are
+// allowed after the first rune so that decomposed letters, like an e
+// followed by a combining acute accent, stay in the identifier.
 func isIdent(r rune) bool {
-	return isIdentStart(r) || unicode.IsDigit(r)
+	return isIdentStart(r) || unicode.IsDigit(r) || unicode.In(r, unicode.Mn, unicode.Mc)
+}
+
+// consumeIdent consumes all the runes which may be a part of an identifier.
+func (l *Lexer) consumeIdent() {
+	for isIdent(l.peek()) {
+		l.consume()
+	}
+}
+
+// lexWord lexes a command word, which is made up of unquoted, interpreted,
+// and raw pieces with no space between them, like foo"bar baz"`qux`. The
+// whole word is emitted as a single string token, and it ends at the next
+// unquoted space rune, ';', '|', '&', single quote, or eof, or a ')' which
+// closes a subshell. Runes escaped with a backslash, including space runes,
+// are part of the word.
+func (l *Lexer) lexWord() {
+	var quoted []int // start and end offsets of the quoted pieces
+	errs := l.ErrCount
+	parens := 0 // number of unclosed '(' in the word
+
+	for r := l.peek(); !l.isWordEnd(r, parens); r = l.peek() {
+		start := l.rdOffset
+		l.consume()
+
+		var ok bool
+		switch r {
+		case '(':
+			parens++
+			continue
+		case ')':
+			if parens > 0 {
+				parens--
+			}
+			continue
+		case '"':
+			ok = l.consumeInterpretedString()
+		case '`':
+			ok = l.consumeRawString()
+		case '\\':
+			l.consumeEscaped()
+			continue
+		default:
+			continue
+		}
+
+		if !ok {
+			// unterminated quoted piece
+			l.emit(token.Illegal)
+			return
+		}
+
+		quoted = append(quoted, start, l.rdOffset)
+	}
+
+	if l.ErrCount > errs {
+		// invalid escape sequences in quoted pieces have been reported
+		l.emit(token.Illegal)
+		return
+	}
+
+	l.emitLiteral(token.String, l.wordLiteral(quoted))
+}
+
+// isWordEnd reports whether r ends a command word with parens unclosed '('
+// runes. A ')' only ends words inside subshells, where it closes the
+// subshell unless it matches a '(' in the word, like in echo foo(bar).
+func (l *Lexer) isWordEnd(r rune, parens int) bool {
+	switch r {
+	case eof, ';', '|', '&', '\'':
+		return true
+	case ')':
+		return parens == 0 && l.subshells > 0
+	default:
+		return unicode.IsSpace(r)
+	}
 }
 
-func (l *lexer) consumeWord() {
-	for r := l.peek(); !unicode.IsSpace(r) && r != eof; r = l.peek() {
+// consumeEscaped consumes the rune after a backslash, if there is one.
+func (l *Lexer) consumeEscaped() {
+	if l.peek() != eof {
 		l.consume()
 	}
 }
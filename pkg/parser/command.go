@@ -15,6 +15,8 @@ package parser
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"laptudirm.com/x/mash/pkg/ast"
 	"laptudirm.com/x/mash/pkg/token"
@@ -110,8 +112,12 @@ func (p *parser) parsePipeCommand() (ast.Command, error) {
 	return expr, nil
 }
 
-// PrimaryCommand = command_arg { command_arg } .
+// PrimaryCommand = Subshell | CommandComponent { CommandComponent } .
 func (p *parser) parsePrimaryCommand() (ast.Command, error) {
+	if p.check(token.LeftParen) {
+		return p.parseSubshell()
+	}
+
 	if !p.check(token.String, token.Template) {
 		return nil, fmt.Errorf("unexpected token %s", p.pTok)
 	}
@@ -126,9 +132,14 @@ componentLoop:
 		case token.String:
 			p.next()
 
+			value, err := unquoteWord(p.lit)
+			if err != nil {
+				return nil, err
+			}
+
 			component = &ast.StringLiteral{
 				Token: p.current(),
-				Value: p.lit,
+				Value: value,
 			}
 		case token.Template:
 			template, err := p.parseTemplateLit()
@@ -148,3 +159,93 @@ componentLoop:
 		Components: components,
 	}, nil
 }
+
+// Subshell = "(" StatementList ")" .
+func (p *parser) parseSubshell() (*ast.SubshellCommand, error) {
+	p.openGroup(token.LeftParen)
+
+	statements := p.parseStatementList(token.RightParen)
+	if !p.closeGroup(token.RightParen) {
+		return nil, fmt.Errorf("expected ')', received %s", p.pTok)
+	}
+
+	return &ast.SubshellCommand{
+		Statements: statements,
+	}, nil
+}
+
+// unquoteWord evaluates the pieces of a command word and joins them, so
+// that a\ b"c d"`e` evaluates to "a bc de". Unquoted pieces lose the
+// backslashes of their escaped runes, while interpreted and raw pieces are
+// unquoted like string literals.
+func unquoteWord(word string) (string, error) {
+	var b strings.Builder
+
+	for len(word) > 0 {
+		n := pieceLen(word)
+		piece := word[:n]
+		word = word[n:]
+
+		switch piece[0] {
+		case '"', '`':
+			if piece[0] == '"' {
+				// interpreted pieces may span multiple lines
+				piece = newlines.Replace(piece)
+			}
+
+			value, err := strconv.Unquote(piece)
+			if err != nil {
+				return "", fmt.Errorf("invalid quoted string %s in word", piece)
+			}
+
+			b.WriteString(value)
+		default:
+			escaped := false
+			for _, r := range piece {
+				if r == '\\' && !escaped {
+					escaped = true
+					continue
+				}
+
+				escaped = false
+				b.WriteRune(r)
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+// pieceLen returns the length of the first piece of word, which is either
+// a quoted string or a run of unquoted runes.
+// newlines escapes the newlines of an interpreted piece, which strconv
+// doesn't allow in interpreted strings.
+var newlines = strings.NewReplacer("\r\n", `\n`, "\n", `\n`)
+
+func pieceLen(word string) int {
+	quote := word[0]
+	if quote == '"' || quote == '`' {
+		for i := 1; i < len(word); i++ {
+			switch {
+			case word[i] == quote:
+				return i + 1
+			case word[i] == '\\' && quote == '"':
+				i++ // skip escaped byte
+			}
+		}
+
+		// unterminated strings are reported by the lexer
+		return len(word)
+	}
+
+	for i := 0; i < len(word); i++ {
+		switch word[i] {
+		case '"', '`':
+			return i
+		case '\\':
+			i++ // escaped quotes are unquoted runes
+		}
+	}
+
+	return len(word)
+}
@@ -237,14 +237,14 @@ func (p *parser) parseSelector(expr ast.Expression) (ast.Expression, error) {
 
 // Index = "[" Expression "]" .
 func (p *parser) parseIndex(expr ast.Expression) (ast.Expression, error) {
-	p.match(token.LeftBrack)
+	p.openGroup(token.LeftBrack)
 
 	name, err := p.parseExpression()
 	if err != nil {
 		return nil, err
 	}
 
-	if !p.match(token.RightBrack) {
+	if !p.closeGroup(token.RightBrack) {
 		return nil, fmt.Errorf("expected '}', received %s", p.pTok)
 	}
 
@@ -258,7 +258,7 @@ func (p *parser) parseIndex(expr ast.Expression) (ast.Expression, error) {
 func (p *parser) parseArguments(expr ast.Expression) (ast.Expression, error) {
 	var args []ast.Expression
 
-	p.match(token.LeftParen)
+	p.openGroup(token.LeftParen)
 	paren := p.current()
 
 	args, err := p.parseExpressionList(token.RightParen)
@@ -266,6 +266,10 @@ func (p *parser) parseArguments(expr ast.Expression) (ast.Expression, error) {
 		return nil, err
 	}
 
+	if !p.closeGroup(token.RightParen) {
+		return nil, fmt.Errorf("expected ')', received %s", p.pTok)
+	}
+
 	return &ast.CallExpression{
 		Callee:      expr,
 		Parenthesis: paren,
@@ -276,17 +280,19 @@ func (p *parser) parseArguments(expr ast.Expression) (ast.Expression, error) {
 // Operand = Literal | "(" Expression ")" .
 func (p *parser) parseOperand() (ast.Expression, error) {
 	switch {
-	case p.match(token.LeftParen):
+	case p.openGroup(token.LeftParen):
 		expr, err := p.parseExpression()
 		if err != nil {
 			return nil, err
 		}
 
-		if !p.match(token.RightParen) {
+		if !p.closeGroup(token.RightParen) {
 			return nil, fmt.Errorf("expected ')', received %s", p.pTok)
 		}
 
-		return expr, nil
+		return &ast.GroupExpression{
+			Right: expr,
+		}, nil
 	default:
 		return p.parseLiteral()
 	}
@@ -344,7 +350,7 @@ func (p *parser) parseBasicLit() (ast.Expression, error) {
 
 // ArrayLit = "[" ExpressionList "]" .
 func (p *parser) parseArrayLit() (*ast.ArrayLiteral, error) {
-	p.match(token.LeftBrack)
+	p.openGroup(token.LeftBrack)
 	brack := p.current()
 
 	list, err := p.parseExpressionList(token.RightBrack)
@@ -352,6 +358,10 @@ func (p *parser) parseArrayLit() (*ast.ArrayLiteral, error) {
 		return nil, err
 	}
 
+	if !p.closeGroup(token.RightBrack) {
+		return nil, fmt.Errorf("expected ']', received %s", p.pTok)
+	}
+
 	return &ast.ArrayLiteral{
 		Token:    brack,
 		Elements: list,
@@ -363,11 +373,11 @@ func (p *parser) parseObjectLit() (*ast.ObjectLiteral, error) {
 	p.match(token.Obj)
 	obj := p.current()
 
-	if !p.match(token.LeftBrack) {
+	if !p.openGroup(token.LeftBrack) {
 		return nil, fmt.Errorf("expected '[', received %s", p.pTok)
 	}
 
-	elements := make(map[ast.Expression]ast.Expression)
+	var elements []*ast.ObjectEntry
 	for !p.check(token.RightBrack) && !p.atEnd() {
 		key, err := p.parseExpression()
 		if err != nil {
@@ -383,14 +393,17 @@ func (p *parser) parseObjectLit() (*ast.ObjectLiteral, error) {
 			return nil, err
 		}
 
-		elements[key] = value
+		elements = append(elements, &ast.ObjectEntry{
+			Key:   key,
+			Value: value,
+		})
 
 		if !p.match(token.Comma) && !p.check(token.RightBrack) {
 			return nil, fmt.Errorf("expected ']', received %s", p.pTok)
 		}
 	}
 
-	if !p.match(token.RightBrack) {
+	if !p.closeGroup(token.RightBrack) {
 		return nil, fmt.Errorf("expected ']', received %s", p.pTok)
 	}
 
@@ -450,10 +463,13 @@ func (p *parser) parseTemplateLit() (*ast.TemplateLiteral, error) {
 }
 
 // ExpressionList = Expression { "," Expression } .
-func (p *parser) parseExpressionList(eol token.Type) ([]ast.Expression, error) {
+//
+// The list ends at any of the tokens in eol, the first of which is the
+// one expected in errors.
+func (p *parser) parseExpressionList(eol ...token.Type) ([]ast.Expression, error) {
 	var list []ast.Expression
 
-	for !p.check(eol) && !p.atEnd() {
+	for !p.check(eol...) && !p.atEnd() {
 		expr, err := p.parseExpression()
 		if err != nil {
 			return nil, err
@@ -461,14 +477,10 @@ func (p *parser) parseExpressionList(eol token.Type) ([]ast.Expression, error) {
 
 		list = append(list, expr)
 
-		if !p.match(token.Comma) && !p.check(eol) {
-			return nil, fmt.Errorf("expected %s, received %s", eol, p.pTok)
+		if !p.match(token.Comma) && !p.check(eol...) {
+			return nil, fmt.Errorf("expected %s, received %s", eol[0], p.pTok)
 		}
 	}
 
-	if !p.match(eol) {
-		return nil, fmt.Errorf("expected %s, received EOF", eol)
-	}
-
 	return list, nil
 }
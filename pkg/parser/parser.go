@@ -14,6 +14,8 @@
 package parser
 
 import (
+	"fmt"
+
 	"laptudirm.com/x/mash/pkg/ast"
 	"laptudirm.com/x/mash/pkg/lexer"
 	"laptudirm.com/x/mash/pkg/token"
@@ -32,6 +34,10 @@ type parser struct {
 	pos token.Position
 	lit string
 
+	// stack of open parenthesis, brackets, and braces
+	groups []token.Token
+	eof    bool // unterminated group has been reported
+
 	err lexer.ErrorHandler
 
 	ErrorCount int
@@ -50,6 +56,43 @@ func Parse(t lexer.TokenStream, e lexer.ErrorHandler) *ast.Program {
 	return p.parseProgram()
 }
 
+// ParseExpr parses a single expression, optionally followed by
+// semicolons, from the token stream t, which is usually returned by
+// lexer.LexExpr. Any errors are reported to e, and nil is returned if
+// the expression could not be parsed.
+func ParseExpr(t lexer.TokenStream, e lexer.ErrorHandler) ast.Expression {
+	p := parser{
+		tokens: t,
+		err:    e,
+	}
+
+	// start token consumption
+	p.next()
+
+	expr, err := p.parseExpression()
+	if err == nil {
+		// explicit and inserted semicolons
+		for p.match(token.Semicolon) {
+		}
+
+		if !p.atEnd() {
+			err = fmt.Errorf("expected EOF, received %s", p.pTok)
+		}
+	}
+
+	if err != nil {
+		p.errorAtToken(err)
+		expr = nil
+	}
+
+	// drain the token stream so the lexer can finish
+	for !p.atEnd() {
+		p.next()
+	}
+
+	return expr
+}
+
 func (p *parser) current() token.Token {
 	return token.Token{
 		Type:     p.tok,
@@ -82,14 +125,13 @@ func (p *parser) atEnd() bool {
 }
 
 func (p *parser) next() {
-	tok := <-p.tokens
-
 	p.tok = p.pTok
 	p.pos = p.pPos
 	p.lit = p.pLit
 
+	tok := p.receive()
 	for tok.Type == token.Comment {
-		tok = <-p.tokens
+		tok = p.receive()
 	}
 
 	p.pTok = tok.Type
@@ -97,6 +139,21 @@ func (p *parser) next() {
 	p.pLit = tok.Literal
 }
 
+// receive receives the next token from the token stream. Once the stream
+// is closed, it keeps returning an EOF token, so the parser never moves
+// past the end of the source.
+func (p *parser) receive() token.Token {
+	tok, ok := <-p.tokens
+	if !ok {
+		return token.Token{
+			Type:     token.Eof,
+			Position: p.pPos,
+		}
+	}
+
+	return tok
+}
+
 func (p *parser) error(pos token.Position, err error) {
 	p.ErrorCount++
 	if p.err != nil {
@@ -104,6 +161,49 @@ func (p *parser) error(pos token.Position, err error) {
 	}
 }
 
+// openGroup matches the opening token open of a group, and pushes it onto
+// the parser's stack of open groups.
+func (p *parser) openGroup(open token.Type) bool {
+	if !p.match(open) {
+		return false
+	}
+
+	p.groups = append(p.groups, p.current())
+	return true
+}
+
+// closeGroup matches the closing token close of the innermost open group,
+// and pops the group from the parser's stack of open groups.
+func (p *parser) closeGroup(close token.Type) bool {
+	if !p.match(close) {
+		return false
+	}
+
+	p.groups = p.groups[:len(p.groups)-1]
+	return true
+}
+
+// errorAtToken reports err at the position of the peek token, unless it
+// is an illegal token. Illegal tokens have already been reported by the
+// lexer, so reporting them again would only duplicate the diagnostic.
+// Errors at the end of the source inside a group are reported once, as an
+// unterminated group at the position of the innermost open group.
+func (p *parser) errorAtToken(err error) {
+	switch {
+	case p.pTok == token.Illegal:
+		// already reported
+	case p.atEnd() && p.eof:
+		// cascading error from the unterminated group
+	case p.atEnd() && len(p.groups) > 0:
+		p.eof = true
+
+		open := p.groups[len(p.groups)-1]
+		p.error(open.Position, fmt.Errorf("%w, unterminated %s", lexer.ErrEOF, open.Type))
+	default:
+		p.error(p.pPos, err)
+	}
+}
+
 func (p *parser) synchronize() {
 	// consume error token
 	p.next()
@@ -116,7 +216,7 @@ func (p *parser) synchronize() {
 
 		switch p.pTok {
 		// check for tokens which start a statement
-		case token.For, token.If, token.Let, token.Break, token.Continue, token.Return:
+		case token.For, token.If, token.Switch, token.Case, token.Default, token.Let, token.Break, token.Continue, token.Return:
 			return
 		default:
 			p.next()
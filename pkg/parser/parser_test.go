@@ -0,0 +1,490 @@
+package parser_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"laptudirm.com/x/mash/pkg/ast"
+	"laptudirm.com/x/mash/pkg/lexer"
+	"laptudirm.com/x/mash/pkg/parser"
+	"laptudirm.com/x/mash/pkg/token"
+)
+
+// parse parses src and fails the test if any errors are reported.
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+
+	handler := func(pos token.Position, err error) {
+		t.Errorf("%s: %v", &pos, err)
+	}
+
+	return parser.Parse(lexer.Lex(src, handler), handler)
+}
+
+func TestSwitchStatement(t *testing.T) {
+	input := `switch x {
+case 1:
+	echo one
+case "two", 3:
+	echo two
+	echo three
+case obj["a": 1]:
+	echo object
+default:
+	echo other
+}
+`
+
+	program := parse(t, input)
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.SwitchStatement)
+	if !ok {
+		t.Fatalf("expected *ast.SwitchStatement, got %T", program.Statements[0])
+	}
+
+	subject, ok := stmt.Subject.(*ast.VariableExpression)
+	if !ok || subject.Name.Literal != "x" {
+		t.Fatalf("expected subject x, got %#v", stmt.Subject)
+	}
+
+	tests := []struct {
+		expectedValues     int
+		expectedStatements int
+	}{
+		{1, 1},
+		{2, 2},
+		{1, 1},
+		{0, 1},
+	}
+
+	if len(stmt.Clauses) != len(tests) {
+		t.Fatalf("expected %d clauses, got %d", len(tests), len(stmt.Clauses))
+	}
+
+	for i, test := range tests {
+		clause := stmt.Clauses[i]
+		if len(clause.Values) != test.expectedValues {
+			t.Errorf("clause %d: expected %d values, got %d", i, test.expectedValues, len(clause.Values))
+		}
+		if len(clause.Statements) != test.expectedStatements {
+			t.Errorf("clause %d: expected %d statements, got %d", i, test.expectedStatements, len(clause.Statements))
+		}
+	}
+
+	if stmt.Clauses[3].Values != nil {
+		t.Errorf("expected default clause to have nil values")
+	}
+}
+
+func TestSwitchStatementErrors(t *testing.T) {
+	tests := []string{
+		"switch x {\ndefault:\ndefault:\n}\n",
+		"switch x {\ncase:\n}\n",
+		"switch x {\necho a\n}\n",
+	}
+
+	for _, input := range tests {
+		count := 0
+		handler := func(token.Position, error) {
+			count++
+		}
+
+		parser.Parse(lexer.Lex(input, handler), handler)
+		if count == 0 {
+			t.Errorf("%q: expected parse errors, got none", input)
+		}
+	}
+
+	// a case clause header missing it's colon ends at the newline, and
+	// is reported once without cascading into the clause's statements
+	input := "switch x {\ncase 1\necho a\n}\n"
+
+	var errs []error
+	handler := func(_ token.Position, err error) {
+		errs = append(errs, err)
+	}
+
+	parser.Parse(lexer.Lex(input, handler), handler)
+	if len(errs) != 1 || errs[0].Error() != "expected ':', received ;" {
+		t.Errorf("%q: expected a single missing colon error, got %v", input, errs)
+	}
+}
+
+// commandWords returns the values of the string components of the command
+// statement stmt.
+func commandWords(t *testing.T, stmt ast.Statement) []string {
+	t.Helper()
+
+	cmd, ok := stmt.(*ast.CmdStatement)
+	if !ok {
+		t.Fatalf("expected *ast.CmdStatement, got %T", stmt)
+	}
+
+	literal, ok := cmd.Command.(*ast.LiteralCommand)
+	if !ok {
+		t.Fatalf("expected *ast.LiteralCommand, got %T", cmd.Command)
+	}
+
+	var words []string
+	for _, component := range literal.Components {
+		str, ok := component.(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("expected *ast.StringLiteral, got %T", component)
+		}
+
+		words = append(words, str.Value)
+	}
+
+	return words
+}
+
+func TestCommandEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`echo a\ b`, []string{"echo", "a b"}},
+		{`echo \| \& \! \;`, []string{"echo", "|", "&", "!", ";"}},
+		{`echo a\|b \$HOME \\`, []string{"echo", "a|b", "$HOME", `\`}},
+		{`echo foo"bar baz"qux`, []string{"echo", "foobar bazqux"}},
+		{"echo \"a\\tb\"`c\\d`\\\"e \"f g\"", []string{"echo", "a\tbc\\d\"e", "f g"}},
+		{"echo \"a\nb\"", []string{"echo", "a\nb"}},
+		{"echo foo(bar) a)b", []string{"echo", "foo(bar)", "a)b"}},
+		{"echo \"a\r\nb\"c", []string{"echo", "a\nbc"}},
+	}
+
+	for _, test := range tests {
+		program := parse(t, test.input)
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, got %d", test.input, len(program.Statements))
+		}
+
+		words := commandWords(t, program.Statements[0])
+		if len(words) != len(test.expected) {
+			t.Fatalf("%q: expected words %q, got %q", test.input, test.expected, words)
+		}
+
+		for i, word := range words {
+			if word != test.expected[i] {
+				t.Errorf("%q: expected word %q, got %q", test.input, test.expected[i], word)
+			}
+		}
+	}
+}
+
+func TestSubshell(t *testing.T) {
+	input := "(cd /tmp; let x := f(1)\n(echo foo(a))) && echo b\n"
+
+	program := parse(t, input)
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(program.Statements))
+	}
+
+	cmd := program.Statements[0].(*ast.CmdStatement)
+	logical, ok := cmd.Command.(*ast.LogicalCommand)
+	if !ok {
+		t.Fatalf("expected *ast.LogicalCommand, got %T", cmd.Command)
+	}
+
+	subshell, ok := logical.Left.(*ast.SubshellCommand)
+	if !ok {
+		t.Fatalf("expected *ast.SubshellCommand, got %T", logical.Left)
+	}
+
+	if len(subshell.Statements) != 3 {
+		t.Fatalf("expected 3 statements in subshell, got %d", len(subshell.Statements))
+	}
+
+	if words := commandWords(t, subshell.Statements[0]); len(words) != 2 || words[0] != "cd" || words[1] != "/tmp" {
+		t.Errorf("expected first statement cd /tmp, got %q", words)
+	}
+
+	if _, ok := subshell.Statements[1].(*ast.LetStatement); !ok {
+		t.Errorf("expected second statement to be *ast.LetStatement, got %T", subshell.Statements[1])
+	}
+
+	nested := subshell.Statements[2].(*ast.CmdStatement)
+	inner, ok := nested.Command.(*ast.SubshellCommand)
+	if !ok {
+		t.Fatalf("expected third statement to be a subshell, got %T", nested.Command)
+	}
+
+	// the ')' of foo(a) doesn't close the subshell
+	if words := commandWords(t, inner.Statements[0]); len(words) != 2 || words[1] != "foo(a)" {
+		t.Errorf("expected nested statement echo foo(a), got %q", words)
+	}
+}
+
+func TestSubshellErrors(t *testing.T) {
+	tests := []string{
+		"(echo a\n",
+		"(echo a))\n",
+		"echo (a)\n",
+	}
+
+	for _, input := range tests {
+		count := 0
+		handler := func(token.Position, error) {
+			count++
+		}
+
+		parser.Parse(lexer.Lex(input, handler), handler)
+		if count == 0 {
+			t.Errorf("%q: expected errors, got none", input)
+		}
+	}
+}
+
+// cmdString returns a fully parenthesized representation of cmd, which
+// shows the shape of the command tree.
+func cmdString(cmd ast.Command) string {
+	switch c := cmd.(type) {
+	case *ast.LogicalCommand:
+		return "(" + cmdString(c.Left) + " " + c.Operator.Literal + " " + cmdString(c.Right) + ")"
+	case *ast.BinaryCommand:
+		return "(" + cmdString(c.Left) + " " + c.Operator.Literal + " " + cmdString(c.Right) + ")"
+	case *ast.UnaryCommand:
+		return "(" + c.Operator.Literal + " " + cmdString(c.Right) + ")"
+	default:
+		return ast.Format(cmd)
+	}
+}
+
+func TestCommandPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a && b || c", "((a && b) || c)"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b && c", "((a && b) && c)"},
+		{"a || b || c", "((a || b) || c)"},
+		{"a | b | c", "((a | b) | c)"},
+		{"a | b && c | d", "((a | b) && (c | d))"},
+		{"! a | b", "(! (a | b))"},
+		{"! a && b", "((! a) && b)"},
+		{"a x | b y || c", "((a x | b y) || c)"},
+		{"(a || b) && c", "((a || b) && c)"},
+		{"a |\n\tb ||\n\n\tc &&\n\td\n", "((a | b) || (c && d))"},
+	}
+
+	for _, test := range tests {
+		program := parse(t, test.input)
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, got %d", test.input, len(program.Statements))
+		}
+
+		cmd, ok := program.Statements[0].(*ast.CmdStatement)
+		if !ok {
+			t.Fatalf("%q: expected *ast.CmdStatement, got %T", test.input, program.Statements[0])
+		}
+
+		if got := cmdString(cmd.Command); got != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.input, test.expected, got)
+		}
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+	tests := []string{
+		"",
+		"   ",
+		"# just a comment",
+		"\n\t\n",
+		"/* block */ # line\r\n",
+	}
+
+	for _, input := range tests {
+		program := parse(t, input)
+		if len(program.Statements) != 0 {
+			t.Errorf("%q: expected no statements, got %d", input, len(program.Statements))
+		}
+	}
+}
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "1 + 2"},
+		{"  (1 + 2) * x\n", "(1 + 2) * x"},
+		{"x", "x"},
+		{"x - y", "x - y"},
+		{"x-y", "x - y"},
+		{"x -y", "x - y"},
+		{"a -b", "a - b"},
+		// flags are valid subtractions, left for the REPL to decide
+		{"ls -la", "ls - la"},
+		{"f(a,\nb)[0];", "f(a, b)[0]"},
+		{"'a {b}' == \"c\"\n", "'a {b}' == \"c\""},
+	}
+
+	for _, test := range tests {
+		handler := func(pos token.Position, err error) {
+			t.Errorf("%q: %s: %v", test.input, &pos, err)
+		}
+
+		expr := parser.ParseExpr(lexer.LexExpr(test.input, handler), handler)
+		if expr == nil {
+			continue
+		}
+
+		if formatted := ast.Format(expr); formatted != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, formatted)
+		}
+	}
+
+	// commands are reported once, by the lexer
+	commands := []string{
+		"git status",
+		"rm file",
+		"  cat file.txt\n",
+	}
+
+	for _, input := range commands {
+		var diagnostics []error
+		handler := func(pos token.Position, err error) {
+			diagnostics = append(diagnostics, err)
+		}
+
+		expr := parser.ParseExpr(lexer.LexExpr(input, handler), handler)
+		if expr != nil || len(diagnostics) != 1 || !errors.Is(diagnostics[0], lexer.ErrCommand) {
+			t.Errorf("%q: expected a command error, got %#v and %v", input, expr, diagnostics)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"1 +",
+		"1 + 2\n3",
+		"echo a | grep b",
+	}
+
+	for _, input := range invalid {
+		count := 0
+		handler := func(token.Position, error) {
+			count++
+		}
+
+		if expr := parser.ParseExpr(lexer.LexExpr(input, handler), handler); expr != nil || count == 0 {
+			t.Errorf("%q: expected an error, got %#v", input, expr)
+		}
+	}
+}
+
+func TestIllegalToken(t *testing.T) {
+	tests := []string{
+		"let x := 1 @ 2\n",
+		"let x := \"abc\n",
+		"echo 'abc\n",
+		"echo a\"bc\n",
+		"if x { let y := $ }\necho a\n",
+		"echo \"a\\qb\"\n",
+	}
+
+	for _, input := range tests {
+		var diagnostics []string
+		handler := func(pos token.Position, err error) {
+			diagnostics = append(diagnostics, fmt.Sprintf("%s: %v", &pos, err))
+		}
+
+		parser.Parse(lexer.Lex(input, handler), handler)
+		if len(diagnostics) != 1 {
+			t.Errorf("%q: expected 1 diagnostic, got %d: %q", input, len(diagnostics), diagnostics)
+		}
+	}
+}
+
+func TestUnterminatedGroup(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   token.Position
+	}{
+		{"(echo a\n", token.Position{Line: 1, Col: 1}},
+		{"if x {\n\techo a\n", token.Position{Line: 1, Col: 6}},
+		{"switch x {\ncase 1:\n", token.Position{Line: 1, Col: 10}},
+		{"let x := (1 + 2\n", token.Position{Line: 1, Col: 10}},
+		{"let x := f(1,\n2\n", token.Position{Line: 1, Col: 11}},
+		{"let x := a[1\n", token.Position{Line: 1, Col: 11}},
+		{"let x := [1, 2\n", token.Position{Line: 1, Col: 10}},
+		{"let x := obj[a: 1\n", token.Position{Line: 1, Col: 13}},
+		{"if x {\n\tlet y := (1 +\n", token.Position{Line: 2, Col: 11}},
+	}
+
+	for _, test := range tests {
+		var diagnostics []string
+		handler := func(pos token.Position, err error) {
+			diagnostics = append(diagnostics, fmt.Sprintf("%s: %v", &pos, err))
+
+			if pos != test.pos || !errors.Is(err, lexer.ErrEOF) {
+				t.Errorf("%q: expected unexpected EOF at %s, got %s: %v", test.input, &test.pos, &pos, err)
+			}
+		}
+
+		parser.Parse(lexer.Lex(test.input, handler), handler)
+		if len(diagnostics) != 1 {
+			t.Errorf("%q: expected 1 diagnostic, got %d: %q", test.input, len(diagnostics), diagnostics)
+		}
+	}
+}
+
+func TestTrailingAmpersand(t *testing.T) {
+	// background commands aren't supported, so a trailing '&' doesn't
+	// continue the command on the next line and is reported
+	input := "echo a &\necho b\n"
+
+	var diagnostics []string
+	handler := func(pos token.Position, err error) {
+		diagnostics = append(diagnostics, fmt.Sprintf("%s: %v", &pos, err))
+	}
+
+	program := parser.Parse(lexer.Lex(input, handler), handler)
+	if expected := []string{"1:8: expected ';', received &"}; !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("expected diagnostics %q, got %q", expected, diagnostics)
+	}
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(program.Statements))
+	}
+
+	if got := ast.Format(program.Statements[0]); got != "echo b" {
+		t.Errorf("expected statement %q, got %q", "echo b", got)
+	}
+}
+
+func TestTemplateJoin(t *testing.T) {
+	tests := []string{
+		"echo 'a b'x\n",
+		"echo x'a b'\n",
+		"echo 'a''b'\n",
+	}
+
+	for _, input := range tests {
+		var diagnostics []error
+		handler := func(pos token.Position, err error) {
+			diagnostics = append(diagnostics, err)
+		}
+
+		program := parser.Parse(lexer.Lex(input, handler), handler)
+		if len(diagnostics) != 1 || !errors.Is(diagnostics[0], lexer.ErrJoin) {
+			t.Errorf("%q: expected a join error, got %v", input, diagnostics)
+		}
+
+		if len(program.Statements) != 0 {
+			t.Errorf("%q: expected no statements, got %d", input, len(program.Statements))
+		}
+	}
+
+	// separated by space, they are different components
+	program := parse(t, "echo 'a b' x\n")
+	cmd := program.Statements[0].(*ast.CmdStatement).Command.(*ast.LiteralCommand)
+	if len(cmd.Components) != 3 {
+		t.Errorf("expected 3 components, got %d", len(cmd.Components))
+	}
+}
@@ -29,12 +29,12 @@ func (p *parser) parseProgram() *ast.Program {
 
 // Block = "{" StatementList "}" .
 func (p *parser) parseBlock() (*ast.BlockStatement, error) {
-	if !p.match(token.LeftBrace) {
+	if !p.openGroup(token.LeftBrace) {
 		return nil, fmt.Errorf("expected '{', received %s", p.pTok)
 	}
 
 	statements := p.parseStatementList(token.RightBrace)
-	if !p.match(token.RightBrace) {
+	if !p.closeGroup(token.RightBrace) {
 		return nil, fmt.Errorf("expected '}', received %s", p.pTok)
 	}
 
@@ -44,13 +44,17 @@ func (p *parser) parseBlock() (*ast.BlockStatement, error) {
 }
 
 // StatementList = { Statement } .
-func (p *parser) parseStatementList(eos token.Type) []ast.Statement {
+func (p *parser) parseStatementList(eos ...token.Type) []ast.Statement {
 	var statements []ast.Statement
 
-	for p.pTok != eos && !p.atEnd() {
+	for !p.check(eos...) && !p.atEnd() {
+		groups := len(p.groups)
+
 		stmt, err := p.parseStatement()
 		if err != nil {
-			p.error(p.pPos, err)
+			p.errorAtToken(err)
+			// forget the groups left open by the statement
+			p.groups = p.groups[:groups]
 			// sync parser to avoid cascading errors
 			p.synchronize()
 			continue
@@ -62,7 +66,7 @@ func (p *parser) parseStatementList(eos token.Type) []ast.Statement {
 	return statements
 }
 
-// Statement = ( LetStatement | ForStatement | IfStatement | Block | CommandStatement ) ";" .
+// Statement = ( LetStatement | ForStatement | IfStatement | SwitchStatement | Block | CommandStatement ) ";" .
 func (p *parser) parseStatement() (ast.Statement, error) {
 	var stmt ast.Statement
 	var err error
@@ -74,9 +78,11 @@ func (p *parser) parseStatement() (ast.Statement, error) {
 		stmt, err = p.parseForStatement()
 	case token.If:
 		stmt, err = p.parseIfStatement()
+	case token.Switch:
+		stmt, err = p.parseSwitchStatement()
 	case token.LeftBrace:
 		stmt, err = p.parseBlock()
-	case token.String, token.Not:
+	case token.String, token.Not, token.LeftParen:
 		stmt, err = p.parseCommandStatement()
 	default:
 		return nil, fmt.Errorf("illegal token %s at line start", p.pTok)
@@ -177,6 +183,94 @@ func (p *parser) parseIfStatement() (*ast.IfStatement, error) {
 	}, nil
 }
 
+// SwitchStatement = "switch" Expression "{" { CaseClause } "}" .
+func (p *parser) parseSwitchStatement() (*ast.SwitchStatement, error) {
+	if !p.match(token.Switch) {
+		return nil, fmt.Errorf("expected 'switch', received %s", p.pTok)
+	}
+
+	subject, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.openGroup(token.LeftBrace) {
+		return nil, fmt.Errorf("expected '{', received %s", p.pTok)
+	}
+
+	var clauses []*ast.CaseClause
+	hasDefault := false
+
+	for !p.check(token.RightBrace) && !p.atEnd() {
+		clause, err := p.parseCaseClause()
+		if err != nil {
+			return nil, err
+		}
+
+		if clause.Values == nil {
+			if hasDefault {
+				return nil, fmt.Errorf("multiple defaults in switch")
+			}
+
+			hasDefault = true
+		}
+
+		clauses = append(clauses, clause)
+	}
+
+	if !p.closeGroup(token.RightBrace) {
+		return nil, fmt.Errorf("expected '}', received %s", p.pTok)
+	}
+
+	return &ast.SwitchStatement{
+		Subject: subject,
+		Clauses: clauses,
+	}, nil
+}
+
+// CaseClause = ( "case" ExpressionList | "default" ) ":" StatementList .
+func (p *parser) parseCaseClause() (*ast.CaseClause, error) {
+	var values []ast.Expression
+
+	switch {
+	case p.match(token.Case):
+		// headers missing their colon end at the newline's semicolon
+		list, err := p.parseExpressionList(token.Colon, token.Semicolon)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(list) == 0 {
+			return nil, fmt.Errorf("expected case value, received %s", p.pTok)
+		}
+
+		if !p.match(token.Colon) {
+			err := fmt.Errorf("expected ':', received %s", p.pTok)
+			if !p.check(token.Semicolon) {
+				return nil, err
+			}
+
+			// the header ended at a newline, so report the missing colon
+			// and parse the clause's statements to avoid cascading errors
+			p.errorAtToken(err)
+			p.next()
+		}
+
+		values = list
+	case p.match(token.Default):
+		if !p.match(token.Colon) {
+			return nil, fmt.Errorf("expected ':', received %s", p.pTok)
+		}
+	default:
+		return nil, fmt.Errorf("expected 'case' or 'default', received %s", p.pTok)
+	}
+
+	return &ast.CaseClause{
+		Values:     values,
+		Statements: p.parseStatementList(token.Case, token.Default, token.RightBrace),
+	}, nil
+}
+
 // CommandStatement = OrCommand .
 func (p *parser) parseCommandStatement() (*ast.CmdStatement, error) {
 	cmd, err := p.parseOrCommand()
@@ -14,7 +14,9 @@
 package token
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 	"unicode"
 )
 
@@ -96,6 +98,9 @@ const (
 	For
 	If
 	Else
+	Switch
+	Case
+	Default
 
 	Let
 	Obj
@@ -170,9 +175,12 @@ var tokens = [...]string{
 	Semicolon:  ";",
 	Colon:      ":",
 
-	For:  "for",
-	If:   "if",
-	Else: "else",
+	For:     "for",
+	If:      "if",
+	Else:    "else",
+	Switch:  "switch",
+	Case:    "case",
+	Default: "default",
 
 	Let:  "let",
 	Obj:  "obj",
@@ -251,6 +259,27 @@ func (tok Type) IsKeyword() bool {
 	return keywordBeg < tok && tok < keywordEnd
 }
 
+// Precedence returns the precedence of the binary operator tok. Operators
+// with a higher precedence bind tighter. If tok is not a binary operator,
+// the result is 0.
+//
+func (tok Type) Precedence() int {
+	switch tok {
+	case LogicalOr:
+		return 1
+	case LogicalAnd:
+		return 2
+	case Equal, NotEqual, LessThan, LessThanEqual, GreaterThan, GreaterThanEqual:
+		return 3
+	case Addition, Subtraction, Or, Xor:
+		return 4
+	case Multiplication, Quotient, Remainder, ShiftLeft, ShiftRight, And, AndNot:
+		return 5
+	default:
+		return 0
+	}
+}
+
 var keywords map[string]Type
 
 func init() {
@@ -271,11 +300,16 @@ func IsKeyword(name string) bool {
 // IsIdentifier returns a boolean depending of wether name is a valid
 // identifier. A string is a valid identifier if it's first letter is
 // an unicode letter(gc = L) or an underscore, while the rest of the
-// characters are letters, underscores, or decimal digits(0-9).
+// characters are letters, underscores, decimal digits(gc = Nd), or
+// combining marks(gc = Mn, Mc).
 //
 func IsIdentifier(name string) bool {
 	for i, c := range name {
-		if !unicode.IsLetter(c) && (i == 0 || !unicode.IsDigit(c)) && c != '_' {
+		if unicode.IsLetter(c) || c == '_' {
+			continue
+		}
+
+		if i == 0 || !unicode.IsDigit(c) && !unicode.In(c, unicode.Mn, unicode.Mc) {
 			return false
 		}
 	}
@@ -306,3 +340,21 @@ type Token struct {
 	Literal  string   // literal in source
 	Position Position // position in source
 }
+
+// String returns a string representation of t, in the format
+// {type "literal" line:column}.
+func (t Token) String() string {
+	return fmt.Sprintf("{%s %q %s}", t.Type, t.Literal, &t.Position)
+}
+
+// Dump returns a string representation of tokens, with each token's string
+// representation on a separate line.
+func Dump(tokens []Token) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteString(t.String())
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
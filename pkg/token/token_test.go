@@ -0,0 +1,59 @@
+package token_test
+
+import (
+	"testing"
+
+	"laptudirm.com/x/mash/pkg/token"
+)
+
+func TestTokenString(t *testing.T) {
+	tests := []struct {
+		tok      token.Token
+		expected string
+	}{
+		{token.Token{Type: token.Identifier, Literal: "foo", Position: token.Position{Line: 1, Col: 3}}, `{IDENT "foo" 1:3}`},
+		{token.Token{Type: token.ShiftLeftAssign, Literal: "<<=", Position: token.Position{Line: 2, Col: 10}}, `{<<= "<<=" 2:10}`},
+		{token.Token{Type: token.Semicolon, Literal: "\n", Position: token.Position{Line: 4, Col: 7}}, `{; "\n" 4:7}`},
+		{token.Token{Type: token.Eof, Position: token.Position{Line: 5, Col: 1}}, `{EOF "" 5:1}`},
+	}
+
+	for i, test := range tests {
+		if s := test.tok.String(); s != test.expected {
+			t.Errorf("case %v: expected %s, got %s", i, test.expected, s)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	tokens := []token.Token{
+		{Type: token.Let, Literal: "let", Position: token.Position{Line: 1, Col: 1}},
+		{Type: token.Identifier, Literal: "x", Position: token.Position{Line: 1, Col: 5}},
+	}
+
+	expected := "{let \"let\" 1:1}\n{IDENT \"x\" 1:5}\n"
+	if s := token.Dump(tokens); s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+}
+
+func TestIsIdentifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"foo", true},
+		{"_foo1", true},
+		{"cafe\u0301", true}, // combining acute accent
+		{"\u0301a", false},
+		{"1a", false},
+		{"a-b", false},
+		{"let", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if ok := token.IsIdentifier(test.name); ok != test.expected {
+			t.Errorf("%q: expected %v, got %v", test.name, test.expected, ok)
+		}
+	}
+}